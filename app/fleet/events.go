@@ -0,0 +1,191 @@
+// Package fleet holds the events published to the fleet.events exchange and
+// consumed from the geofence_alerts queue.
+package fleet
+
+import (
+	"strconv"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+)
+
+// GeofenceEvent is published when a vehicle enters, exits or dwells in a geofence
+// or leaves and returns to a corridor
+type GeofenceEvent struct {
+	ID           uint   `json:"id,omitempty"` // ID di tabel geofence_events
+	VehicleID    string `json:"vehicle_id"`
+	VehicleName  string `json:"vehicle_name"`
+	GeofenceID   uint   `json:"geofence_id"`
+	GeofenceName string `json:"geofence_name"`
+	Event        string `json:"event"`
+	Location     struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"`
+	Distance  float64 `json:"distance,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// NewGeofenceEvent builds the event published for a geofence transition
+func NewGeofenceEvent(vehicle models.Vehicle, transition geofence.Transition) GeofenceEvent {
+	event := GeofenceEvent{
+		ID:           transition.EventID,
+		VehicleID:    strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName:  vehicle.Name,
+		GeofenceID:   transition.Geofence.ID,
+		GeofenceName: transition.Geofence.Name,
+		Event:        transition.Event,
+		Distance:     transition.Distance,
+		Timestamp:    transition.Timestamp.Unix(),
+	}
+	event.Location.Latitude = transition.Latitude
+	event.Location.Longitude = transition.Longitude
+	return event
+}
+
+// RuleEvent is published when an operator defined rule starts matching a vehicle
+type RuleEvent struct {
+	ID           uint   `json:"id,omitempty"` // ID di tabel rule_events
+	RuleID       uint   `json:"rule_id"`
+	RuleName     string `json:"rule_name"`
+	VehicleID    string `json:"vehicle_id"`
+	VehicleName  string `json:"vehicle_name"`
+	GeofenceID   uint   `json:"geofence_id,omitempty"`
+	GeofenceName string `json:"geofence_name,omitempty"`
+	Event        string `json:"event"`
+	Location     struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"`
+	Speed     *float64 `json:"speed,omitempty"` // dalam km/jam
+	Timestamp int64    `json:"timestamp"`
+}
+
+// NewRuleEvent builds the event published for a recorded rule event
+func NewRuleEvent(vehicle models.Vehicle, rule models.Rule, recorded models.RuleEvent) RuleEvent {
+	event := RuleEvent{
+		ID:          recorded.ID,
+		RuleID:      rule.ID,
+		RuleName:    rule.Name,
+		VehicleID:   strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName: vehicle.Name,
+		Event:       recorded.Event,
+		Speed:       recorded.Speed,
+		Timestamp:   recorded.Timestamp.Unix(),
+	}
+	if recorded.GeofenceID != nil {
+		event.GeofenceID = *recorded.GeofenceID
+	}
+	if rule.Geofence != nil {
+		event.GeofenceName = rule.Geofence.Name
+	}
+	event.Location.Latitude = recorded.Latitude
+	event.Location.Longitude = recorded.Longitude
+	return event
+}
+
+// ConnectivityEvent is published when a vehicle stops reporting its location
+// or reports again after being offline
+type ConnectivityEvent struct {
+	VehicleID   string `json:"vehicle_id"`
+	VehicleName string `json:"vehicle_name"`
+	Event       string `json:"event"`
+	Location    struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"` // posisi terakhir untuk offline, posisi baru untuk online
+	LastSeen     int64 `json:"last_seen,omitempty"`     // timestamp lokasi terakhir, hanya untuk offline
+	OfflineSince int64 `json:"offline_since,omitempty"` // sejak kapan kendaraan offline
+	Timestamp    int64 `json:"timestamp"`
+}
+
+// NewConnectivityEvent builds a connectivity event of the vehicle at the given position
+func NewConnectivityEvent(vehicle models.Vehicle, eventType string, lat, lon float64, at time.Time) ConnectivityEvent {
+	event := ConnectivityEvent{
+		VehicleID:   strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName: vehicle.Name,
+		Event:       eventType,
+		Timestamp:   at.Unix(),
+	}
+	event.Location.Latitude = lat
+	event.Location.Longitude = lon
+	return event
+}
+
+// OverspeedEvent is published once a vehicle exceeded the speed limit of a
+// geofence for longer than the minimum duration
+type OverspeedEvent struct {
+	ViolationID  uint   `json:"violation_id"` // ID di tabel overspeed_violations
+	VehicleID    string `json:"vehicle_id"`
+	VehicleName  string `json:"vehicle_name"`
+	GeofenceID   uint   `json:"geofence_id"`
+	GeofenceName string `json:"geofence_name"`
+	Event        string `json:"event"`
+	Location     struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"` // posisi saat kecepatan puncak
+	SpeedLimit float64 `json:"speed_limit"` // dalam km/jam
+	PeakSpeed  float64 `json:"peak_speed"`  // dalam km/jam
+	Duration   float64 `json:"duration"`    // dalam detik
+	StartedAt  int64   `json:"started_at"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// NewOverspeedEvent builds the event published for an overspeed violation
+func NewOverspeedEvent(vehicle models.Vehicle, geofence models.Geofence, eventType string, violation models.OverspeedViolation) OverspeedEvent {
+	event := OverspeedEvent{
+		ViolationID:  violation.ID,
+		VehicleID:    strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName:  vehicle.Name,
+		GeofenceID:   geofence.ID,
+		GeofenceName: geofence.Name,
+		Event:        eventType,
+		SpeedLimit:   violation.SpeedLimit,
+		PeakSpeed:    violation.PeakSpeed,
+		Duration:     violation.DurationSeconds,
+		StartedAt:    violation.StartedAt.Unix(),
+		Timestamp:    violation.LastAt.Unix(),
+	}
+	event.Location.Latitude = violation.Latitude
+	event.Location.Longitude = violation.Longitude
+	return event
+}
+
+// IdleEvent is published when a vehicle stood still longer than the idle threshold
+type IdleEvent struct {
+	StopID       uint   `json:"stop_id"` // ID di tabel stops
+	VehicleID    string `json:"vehicle_id"`
+	VehicleName  string `json:"vehicle_name"`
+	GeofenceID   uint   `json:"geofence_id,omitempty"`
+	GeofenceName string `json:"geofence_name,omitempty"`
+	Event        string `json:"event"`
+	Location     struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"location"`
+	Duration  float64 `json:"duration"` // dalam detik
+	StartedAt int64   `json:"started_at"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// NewIdleEvent builds the event published for a stop, geofence is nil when the
+// vehicle stopped outside every known geofence
+func NewIdleEvent(vehicle models.Vehicle, geofence *models.Geofence, eventType string, stop models.Stop) IdleEvent {
+	event := IdleEvent{
+		StopID:      stop.ID,
+		VehicleID:   strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName: vehicle.Name,
+		Event:       eventType,
+		Duration:    stop.DurationSeconds,
+		StartedAt:   stop.StartedAt.Unix(),
+		Timestamp:   stop.LastAt.Unix(),
+	}
+	if geofence != nil {
+		event.GeofenceID = geofence.ID
+		event.GeofenceName = geofence.Name
+	}
+	event.Location.Latitude = stop.Latitude
+	event.Location.Longitude = stop.Longitude
+	return event
+}
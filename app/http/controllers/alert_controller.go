@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/alert"
+	"tj_techtest/config"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxAlertLimit caps the page size of the alert list
+const maxAlertLimit = 1000
+
+type AlertController struct{}
+
+type AcknowledgeAlertRequest struct {
+	User     string `json:"user" validate:"required"`
+	Assignee string `json:"assignee"` // default: user yang melakukan acknowledge
+	Notes    string `json:"notes"`
+}
+
+type ResolveAlertRequest struct {
+	User  string `json:"user" validate:"required"`
+	Notes string `json:"notes"`
+}
+
+var alertValidator = validator.New()
+
+// GetAlerts returns alerts, newest first, filtered by status (comma separated),
+// assignee, rule_id and the event filters of GetGeofenceEvents
+func (c *AlertController) GetAlerts(ctx *fiber.Ctx) error {
+	query, err := filterEvents(ctx, config.DB.Preload("Vehicle").Preload("Geofence").Preload("Rule"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if statuses := parseList(ctx.Query("status")); len(statuses) > 0 {
+		names := make([]string, 0, len(statuses))
+		for status := range statuses {
+			if !validAlertStatus(status) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": "Invalid status",
+				})
+			}
+			names = append(names, status)
+		}
+		query = query.Where("status IN ?", names)
+	}
+	if assignee := ctx.Query("assignee"); assignee != "" {
+		query = query.Where("assignee = ?", assignee)
+	}
+	if id := ctx.Query("rule_id"); id != "" {
+		ruleID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid rule ID",
+			})
+		}
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	limit, offset := parsePage(ctx, maxAlertLimit)
+
+	alerts := []models.Alert{}
+	err = query.Order("timestamp DESC, id DESC").Limit(limit).Offset(offset).Find(&alerts).Error
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting alerts",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Alerts retrieved successfully",
+		"data":    alerts,
+	})
+}
+
+// GetAlert returns a specific alert
+func (c *AlertController) GetAlert(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid alert ID",
+		})
+	}
+
+	var a models.Alert
+	if err := config.DB.Preload("Vehicle").Preload("Geofence").Preload("Rule").First(&a, id).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Alert not found",
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Alert retrieved successfully",
+		"data":    a,
+	})
+}
+
+// AcknowledgeAlert marks an open alert as being handled
+func (c *AlertController) AcknowledgeAlert(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid alert ID",
+		})
+	}
+
+	var req AcknowledgeAlertRequest
+	if invalid := parseAlertRequest(ctx, &req); invalid != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	a, err := alert.Acknowledge(config.DB, uint(id), req.User, req.Assignee, req.Notes)
+	if err != nil {
+		return alertError(ctx, "Error acknowledging alert", err)
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Alert acknowledged successfully",
+		"data":    a,
+	})
+}
+
+// ResolveAlert closes an open or acknowledged alert
+func (c *AlertController) ResolveAlert(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid alert ID",
+		})
+	}
+
+	var req ResolveAlertRequest
+	if invalid := parseAlertRequest(ctx, &req); invalid != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	a, err := alert.Resolve(config.DB, uint(id), req.User, req.Notes)
+	if err != nil {
+		return alertError(ctx, "Error resolving alert", err)
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Alert resolved successfully",
+		"data":    a,
+	})
+}
+
+// parseAlertRequest parses and validates the body of a status change,
+// returning the bad request response when it is invalid
+func parseAlertRequest(ctx *fiber.Ctx, req interface{}) fiber.Map {
+	if err := ctx.BodyParser(req); err != nil {
+		return fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		}
+	}
+	if err := alertValidator.Struct(req); err != nil {
+		return fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		}
+	}
+	return nil
+}
+
+func alertError(ctx *fiber.Ctx, message string, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, alert.ErrNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, alert.ErrInvalidTransition):
+		status = fiber.StatusConflict
+	}
+	return ctx.Status(status).JSON(fiber.Map{
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+func validAlertStatus(status string) bool {
+	switch status {
+	case models.AlertStatusOpen, models.AlertStatusAcknowledged, models.AlertStatusResolved:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"errors"
+	"tj_techtest/pkg/rabbitmq"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DeadLetterController struct {
+	RabbitMQ *rabbitmq.Client
+}
+
+// GetDeadLetters returns dead-lettered location messages without removing them
+func (c *DeadLetterController) GetDeadLetters(ctx *fiber.Ctx) error {
+	limit := ctx.QueryInt("limit", 100)
+
+	letters, err := c.RabbitMQ.PeekDeadLetters(limit)
+	if err != nil {
+		return ctx.Status(deadLetterErrorStatus(err)).JSON(fiber.Map{
+			"message": "Error getting dead letters",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Dead letters retrieved successfully",
+		"data":    letters,
+	})
+}
+
+// ReplayDeadLetters republishes dead-lettered location messages for processing
+func (c *DeadLetterController) ReplayDeadLetters(ctx *fiber.Ctx) error {
+	limit := ctx.QueryInt("limit", 100)
+
+	replayed, err := c.RabbitMQ.ReplayDeadLetters(ctx.UserContext(), limit)
+	if err != nil {
+		return ctx.Status(deadLetterErrorStatus(err)).JSON(fiber.Map{
+			"message":  "Error replaying dead letters",
+			"error":    err.Error(),
+			"replayed": replayed,
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message":  "Dead letters replayed successfully",
+		"replayed": replayed,
+	})
+}
+
+func deadLetterErrorStatus(err error) int {
+	if errors.Is(err, rabbitmq.ErrNotConnected) {
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusInternalServerError
+}
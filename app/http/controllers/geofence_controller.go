@@ -1,29 +1,96 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"strconv"
 	"tj_techtest/app/models"
+	geofenceService "tj_techtest/app/services/geofence"
 	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type GeofenceController struct{}
 
 type CreateGeofenceRequest struct {
-	Name      string  `json:"name" validate:"required"`
-	Latitude  float64 `json:"latitude" validate:"required"`
-	Longitude float64 `json:"longitude" validate:"required"`
-	Radius    float64 `json:"radius" validate:"required,min=1"`
+	Name       string           `json:"name" validate:"required"`
+	Type       string           `json:"type" validate:"oneof=circle polygon corridor"`
+	Latitude   float64          `json:"latitude" validate:"required_if=Type circle"`
+	Longitude  float64          `json:"longitude" validate:"required_if=Type circle"`
+	Radius     float64          `json:"radius" validate:"required_if=Type circle,omitempty,min=1"`
+	Geometry   *models.Geometry `json:"geometry" validate:"required_unless=Type circle"`
+	Buffer     float64          `json:"buffer" validate:"required_if=Type corridor,omitempty,min=1"`
+	SpeedLimit *float64         `json:"speed_limit" validate:"omitempty,gt=0"` // km/jam
+	VehicleIDs []uint           `json:"vehicle_ids"`
 }
 
 var validate = validator.New()
 
+// applyTo copies the requested shape onto the geofence, validating GeoJSON geometries
+func (r *CreateGeofenceRequest) applyTo(geofence *models.Geofence) error {
+	geofence.Name = r.Name
+	geofence.Type = r.Type
+	geofence.SpeedLimit = r.SpeedLimit
+
+	switch r.Type {
+	case models.GeofenceTypePolygon:
+		if _, err := geo.ParseGeoJSON(r.Geometry.Type, r.Geometry.Coordinates); err != nil {
+			return err
+		}
+		geofence.Latitude = 0
+		geofence.Longitude = 0
+		geofence.Radius = 0
+		geofence.Geometry = r.Geometry
+		geofence.Buffer = 0
+	case models.GeofenceTypeCorridor:
+		if _, err := geo.ParseLineString(r.Geometry.Type, r.Geometry.Coordinates); err != nil {
+			return err
+		}
+		geofence.Latitude = 0
+		geofence.Longitude = 0
+		geofence.Radius = 0
+		geofence.Geometry = r.Geometry
+		geofence.Buffer = r.Buffer
+	default:
+		geofence.Latitude = r.Latitude
+		geofence.Longitude = r.Longitude
+		geofence.Radius = r.Radius
+		geofence.Geometry = nil
+		geofence.Buffer = 0
+	}
+	return nil
+}
+
+// reloadGeofenceIndex refreshes the in-memory geofence index used during ingestion
+func reloadGeofenceIndex(id uint) {
+	if err := geofenceService.ReloadGeofence(id); err != nil {
+		log.Printf("Failed to refresh geofence %d in index: %v", id, err)
+	}
+}
+
+// findVehicles loads the vehicles assigned to a geofence, failing if any ID is unknown
+func findVehicles(ids []uint) ([]models.Vehicle, error) {
+	vehicles := []models.Vehicle{}
+	if len(ids) == 0 {
+		return vehicles, nil
+	}
+	if err := config.DB.Find(&vehicles, ids).Error; err != nil {
+		return nil, err
+	}
+	if len(vehicles) != len(ids) {
+		return nil, errors.New("one or more vehicle_ids do not exist")
+	}
+	return vehicles, nil
+}
+
 // GetGeofences returns all geofences
 func (c *GeofenceController) GetGeofences(ctx *fiber.Ctx) error {
 	var geofences []models.Geofence
-	result := config.DB.Find(&geofences)
+	result := config.DB.Preload("Vehicles").Find(&geofences)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error getting geofences",
@@ -47,6 +114,10 @@ func (c *GeofenceController) CreateGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if req.Type == "" {
+		req.Type = models.GeofenceTypeCircle
+	}
+
 	// Validate request
 	if err := validate.Struct(req); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -55,14 +126,24 @@ func (c *GeofenceController) CreateGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
-	geofence := models.Geofence{
-		Name:      req.Name,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
-		Radius:    req.Radius,
+	var geofence models.Geofence
+	if err := req.applyTo(&geofence); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid geometry",
+			"error":   err.Error(),
+		})
 	}
 
-	result := config.DB.Create(&geofence)
+	vehicles, err := findVehicles(req.VehicleIDs)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid vehicle_ids",
+			"error":   err.Error(),
+		})
+	}
+	geofence.Vehicles = vehicles
+
+	result := config.DB.Omit("Vehicles.*").Create(&geofence)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error creating geofence",
@@ -70,6 +151,8 @@ func (c *GeofenceController) CreateGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
+	reloadGeofenceIndex(geofence.ID)
+
 	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Geofence created successfully",
 		"data":    geofence,
@@ -87,7 +170,7 @@ func (c *GeofenceController) GetGeofence(ctx *fiber.Ctx) error {
 	}
 
 	var geofence models.Geofence
-	result := config.DB.First(&geofence, geofenceID)
+	result := config.DB.Preload("Vehicles").First(&geofence, geofenceID)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"message": "Geofence not found",
@@ -118,6 +201,10 @@ func (c *GeofenceController) UpdateGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if req.Type == "" {
+		req.Type = models.GeofenceTypeCircle
+	}
+
 	// Validate request
 	if err := validate.Struct(req); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -134,19 +221,36 @@ func (c *GeofenceController) UpdateGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
-	geofence.Name = req.Name
-	geofence.Latitude = req.Latitude
-	geofence.Longitude = req.Longitude
-	geofence.Radius = req.Radius
+	if err := req.applyTo(&geofence); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid geometry",
+			"error":   err.Error(),
+		})
+	}
 
-	result = config.DB.Save(&geofence)
-	if result.Error != nil {
+	vehicles, err := findVehicles(req.VehicleIDs)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid vehicle_ids",
+			"error":   err.Error(),
+		})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Vehicles").Save(&geofence).Error; err != nil {
+			return err
+		}
+		return tx.Model(&geofence).Omit("Vehicles.*").Association("Vehicles").Replace(vehicles)
+	})
+	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error updating geofence",
-			"error":   result.Error.Error(),
+			"error":   err.Error(),
 		})
 	}
 
+	reloadGeofenceIndex(geofence.ID)
+
 	return ctx.JSON(fiber.Map{
 		"message": "Geofence updated successfully",
 		"data":    geofence,
@@ -177,6 +281,8 @@ func (c *GeofenceController) DeleteGeofence(ctx *fiber.Ctx) error {
 		})
 	}
 
+	reloadGeofenceIndex(uint(geofenceID))
+
 	return ctx.JSON(fiber.Map{
 		"message": "Geofence deleted successfully",
 	})
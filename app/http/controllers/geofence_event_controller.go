@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxGeofenceEventLimit caps the page size of the event history
+const maxGeofenceEventLimit = 1000
+
+// filterEvents applies the event filters of the request to a table with
+// vehicle_id, geofence_id, event and timestamp columns: vehicle_id, geofence_id,
+// event (comma separated) and a start/end unix time range
+func filterEvents(ctx *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if id := ctx.Query("vehicle_id"); id != "" {
+		vehicleID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, errors.New("Invalid vehicle ID")
+		}
+		query = query.Where("vehicle_id = ?", vehicleID)
+	}
+
+	geofenceID, err := parseGeofenceID(ctx)
+	if err != nil {
+		return nil, errors.New("Invalid geofence ID")
+	}
+	if geofenceID != 0 {
+		query = query.Where("geofence_id = ?", geofenceID)
+	}
+
+	if events := parseList(ctx.Query("event")); len(events) > 0 {
+		names := make([]string, 0, len(events))
+		for name := range events {
+			names = append(names, name)
+		}
+		query = query.Where("event IN ?", names)
+	}
+
+	startTimestamp, err := strconv.ParseInt(ctx.Query("start", "0"), 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid start timestamp")
+	}
+	endTimestamp, err := strconv.ParseInt(ctx.Query("end", "0"), 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid end timestamp")
+	}
+	if startTimestamp > 0 {
+		query = query.Where("timestamp >= ?", time.Unix(startTimestamp, 0))
+	}
+	if endTimestamp > 0 {
+		query = query.Where("timestamp <= ?", time.Unix(endTimestamp, 0))
+	}
+	return query, nil
+}
+
+// parsePage reads limit (default 100, at most max) and offset
+func parsePage(ctx *fiber.Ctx, max int) (limit, offset int) {
+	limit = ctx.QueryInt("limit", 100)
+	if limit <= 0 || limit > max {
+		limit = max
+	}
+	offset = ctx.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+type GeofenceEventController struct{}
+
+// GetGeofenceEvents returns recorded geofence events, newest first, filtered by
+// vehicle_id, geofence_id, event (comma separated) and a start/end time range
+func (c *GeofenceEventController) GetGeofenceEvents(ctx *fiber.Ctx) error {
+	query, err := filterEvents(ctx, config.DB.Preload("Vehicle").Preload("Geofence"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	limit, offset := parsePage(ctx, maxGeofenceEventLimit)
+
+	events := []models.GeofenceEvent{}
+	err = query.Order("timestamp DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting geofence events",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Geofence events retrieved successfully",
+		"data":    events,
+	})
+}
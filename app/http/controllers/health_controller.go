@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"tj_techtest/app/services/health"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthController struct{}
+
+// GetHealth reports the state of the database, message brokers and other registered dependencies
+func (c *HealthController) GetHealth(ctx *fiber.Ctx) error {
+	results, healthy := health.Run()
+
+	status := fiber.StatusOK
+	message := "Service is healthy"
+	if !healthy {
+		status = fiber.StatusServiceUnavailable
+		message = "Service is unhealthy"
+	}
+
+	return ctx.Status(status).JSON(fiber.Map{
+		"message": message,
+		"data":    results,
+	})
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/rule"
+	"tj_techtest/config"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type RuleController struct{}
+
+type CreateRuleRequest struct {
+	Name            string   `json:"name" validate:"required"`
+	Event           string   `json:"event" validate:"required,max=50"`
+	Enabled         *bool    `json:"enabled"` // default true
+	GeofenceID      *uint    `json:"geofence_id"`
+	StartTime       *string  `json:"start_time" validate:"required_with=EndTime"`
+	EndTime         *string  `json:"end_time" validate:"required_with=StartTime"`
+	SpeedAbove      *float64 `json:"speed_above" validate:"omitempty,gt=0"`
+	NoUpdateSeconds *int     `json:"no_update_seconds" validate:"omitempty,min=1"`
+	VehicleIDs      []uint   `json:"vehicle_ids"`
+}
+
+// applyTo copies the requested conditions onto the rule, checking that there
+// is at least one and that the time window and geofence are valid
+func (r *CreateRuleRequest) applyTo(target *models.Rule) error {
+	if r.GeofenceID == nil && r.StartTime == nil && r.SpeedAbove == nil && r.NoUpdateSeconds == nil {
+		return errors.New("a rule needs at least one of geofence_id, start_time/end_time, speed_above or no_update_seconds")
+	}
+
+	if r.StartTime != nil {
+		start, err := rule.ParseClock(*r.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := rule.ParseClock(*r.EndTime)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return errors.New("start_time and end_time must differ")
+		}
+	}
+
+	if r.GeofenceID != nil {
+		var geofence models.Geofence
+		if err := config.DB.First(&geofence, *r.GeofenceID).Error; err != nil {
+			return errors.New("geofence_id does not exist")
+		}
+	}
+
+	target.Name = r.Name
+	target.Event = r.Event
+	target.Enabled = r.Enabled == nil || *r.Enabled
+	target.GeofenceID = r.GeofenceID
+	target.StartTime = r.StartTime
+	target.EndTime = r.EndTime
+	target.SpeedAbove = r.SpeedAbove
+	target.NoUpdateSeconds = r.NoUpdateSeconds
+	return nil
+}
+
+// parseRuleRequest parses and validates a rule body, returning the bad
+// request response when it is invalid
+func parseRuleRequest(ctx *fiber.Ctx, target *models.Rule) fiber.Map {
+	var req CreateRuleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		}
+	}
+
+	// Validate request
+	if err := validate.Struct(req); err != nil {
+		return fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		}
+	}
+	if err := req.applyTo(target); err != nil {
+		return fiber.Map{
+			"message": "Invalid rule",
+			"error":   err.Error(),
+		}
+	}
+
+	vehicles, err := findVehicles(req.VehicleIDs)
+	if err != nil {
+		return fiber.Map{
+			"message": "Invalid vehicle_ids",
+			"error":   err.Error(),
+		}
+	}
+	target.Vehicles = vehicles
+	return nil
+}
+
+// GetRules returns all rules
+func (c *RuleController) GetRules(ctx *fiber.Ctx) error {
+	var rules []models.Rule
+	result := config.DB.Preload("Vehicles").Find(&rules)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting rules",
+			"error":   result.Error.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Rules retrieved successfully",
+		"data":    rules,
+	})
+}
+
+// CreateRule creates a new rule
+func (c *RuleController) CreateRule(ctx *fiber.Ctx) error {
+	var r models.Rule
+	if invalid := parseRuleRequest(ctx, &r); invalid != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+
+	result := config.DB.Omit("Vehicles.*").Create(&r)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error creating rule",
+			"error":   result.Error.Error(),
+		})
+	}
+
+	rule.Reload()
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Rule created successfully",
+		"data":    r,
+	})
+}
+
+// GetRule returns a specific rule
+func (c *RuleController) GetRule(ctx *fiber.Ctx) error {
+	ruleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid rule ID",
+		})
+	}
+
+	var r models.Rule
+	result := config.DB.Preload("Vehicles").Preload("Geofence").First(&r, ruleID)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Rule not found",
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Rule retrieved successfully",
+		"data":    r,
+	})
+}
+
+// UpdateRule updates a rule. The rule starts over for every vehicle, so it
+// fires again for vehicles that already match the new conditions.
+func (c *RuleController) UpdateRule(ctx *fiber.Ctx) error {
+	ruleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid rule ID",
+		})
+	}
+
+	var r models.Rule
+	result := config.DB.First(&r, ruleID)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Rule not found",
+		})
+	}
+
+	if invalid := parseRuleRequest(ctx, &r); invalid != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(invalid)
+	}
+	vehicles := r.Vehicles
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Vehicles").Save(&r).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&r).Omit("Vehicles.*").Association("Vehicles").Replace(vehicles); err != nil {
+			return err
+		}
+		return tx.Where("rule_id = ?", r.ID).Delete(&models.RuleState{}).Error
+	})
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error updating rule",
+			"error":   err.Error(),
+		})
+	}
+
+	rule.Reload()
+
+	return ctx.JSON(fiber.Map{
+		"message": "Rule updated successfully",
+		"data":    r,
+	})
+}
+
+// DeleteRule deletes a rule
+func (c *RuleController) DeleteRule(ctx *fiber.Ctx) error {
+	ruleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid rule ID",
+		})
+	}
+
+	result := config.DB.Delete(&models.Rule{}, ruleID)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error deleting rule",
+			"error":   result.Error.Error(),
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Rule not found",
+		})
+	}
+
+	rule.Reload()
+
+	return ctx.JSON(fiber.Map{
+		"message": "Rule deleted successfully",
+	})
+}
+
+// GetRuleEvents returns the recorded events of a rule, newest first, with the
+// event filters of GetGeofenceEvents
+func (c *RuleController) GetRuleEvents(ctx *fiber.Ctx) error {
+	ruleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid rule ID",
+		})
+	}
+
+	query, err := filterEvents(ctx, config.DB.Preload("Vehicle").Where("rule_id = ?", ruleID))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	limit, offset := parsePage(ctx, maxGeofenceEventLimit)
+
+	events := []models.RuleEvent{}
+	err = query.Order("timestamp DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting rule events",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Rule events retrieved successfully",
+		"data":    events,
+	})
+}
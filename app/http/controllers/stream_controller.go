@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tj_techtest/app/services/stream"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// streamWriteTimeout disconnects WebSocket clients that stop reading
+const streamWriteTimeout = 10 * time.Second
+
+type StreamController struct{}
+
+// parseList splits a comma separated query parameter, returning nil when it is empty
+func parseList(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	items := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items[item] = true
+		}
+	}
+	return items
+}
+
+// parseGeofenceID reads the optional geofence_id query parameter
+func parseGeofenceID(ctx *fiber.Ctx) (uint, error) {
+	id := ctx.Query("geofence_id")
+	if id == "" {
+		return 0, nil
+	}
+	geofenceID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, errors.New("Invalid geofence_id")
+	}
+	return uint(geofenceID), nil
+}
+
+// parseLocationFilter reads the subscription filter of a location stream:
+// vehicle_ids (comma separated IDs or names), the bounding box and geofence_id
+func parseLocationFilter(ctx *fiber.Ctx) (stream.LocationFilter, error) {
+	filter := stream.LocationFilter{Vehicles: parseList(ctx.Query("vehicle_ids"))}
+
+	box, err := parseBoundingBox(ctx)
+	if err != nil {
+		return filter, err
+	}
+	filter.Box = box
+
+	filter.GeofenceID, err = parseGeofenceID(ctx)
+	return filter, err
+}
+
+// parseGeofenceEventFilter reads the subscription filter of a geofence event
+// stream: vehicle_ids, geofence_id and event (comma separated event types)
+func parseGeofenceEventFilter(ctx *fiber.Ctx) (stream.GeofenceEventFilter, error) {
+	filter := stream.GeofenceEventFilter{
+		Vehicles: parseList(ctx.Query("vehicle_ids")),
+		Events:   parseList(ctx.Query("event")),
+	}
+
+	var err error
+	filter.GeofenceID, err = parseGeofenceID(ctx)
+	return filter, err
+}
+
+// StreamLocationsSSE pushes stored locations as Server-Sent Events
+func (c *StreamController) StreamLocationsSSE(ctx *fiber.Ctx) error {
+	filter, err := parseLocationFilter(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return streamSSE(ctx, stream.SubscribeLocations(filter), "location")
+}
+
+// StreamGeofenceEventsSSE pushes geofence events as Server-Sent Events
+func (c *StreamController) StreamGeofenceEventsSSE(ctx *fiber.Ctx) error {
+	filter, err := parseGeofenceEventFilter(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return streamSSE(ctx, stream.SubscribeGeofenceEvents(filter), "geofence_event")
+}
+
+// streamSSE writes the messages of the subscription as SSE events with the given name
+func streamSSE(ctx *fiber.Ctx, subscription *stream.Subscription, event string) error {
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Set("X-Accel-Buffering", "no") // matikan buffering di reverse proxy (nginx)
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer subscription.Close()
+
+		heartbeat := time.NewTicker(stream.HeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case message, ok := <-subscription.Messages():
+				if !ok {
+					data, _ := json.Marshal(fiber.Map{"error": subscription.Err().Error()})
+					fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+					w.Flush()
+					return
+				}
+				data, err := json.Marshal(message)
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// Flush fails once the client has disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// UpgradeLocations validates the filter of a location WebSocket before the upgrade
+func (c *StreamController) UpgradeLocations(ctx *fiber.Ctx) error {
+	filter, err := parseLocationFilter(ctx)
+	return upgrade(ctx, filter, err)
+}
+
+// UpgradeGeofenceEvents validates the filter of a geofence event WebSocket before the upgrade
+func (c *StreamController) UpgradeGeofenceEvents(ctx *fiber.Ctx) error {
+	filter, err := parseGeofenceEventFilter(ctx)
+	return upgrade(ctx, filter, err)
+}
+
+// upgrade passes the parsed filter on to the WebSocket handler
+func upgrade(ctx *fiber.Ctx, filter stream.Filter, err error) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	ctx.Locals("filter", filter)
+	return ctx.Next()
+}
+
+// StreamLocationsWS pushes stored locations as WebSocket text messages
+func (c *StreamController) StreamLocationsWS(conn *websocket.Conn) {
+	filter, _ := conn.Locals("filter").(stream.LocationFilter)
+	streamWS(conn, stream.SubscribeLocations(filter))
+}
+
+// StreamGeofenceEventsWS pushes geofence events as WebSocket text messages
+func (c *StreamController) StreamGeofenceEventsWS(conn *websocket.Conn) {
+	filter, _ := conn.Locals("filter").(stream.GeofenceEventFilter)
+	streamWS(conn, stream.SubscribeGeofenceEvents(filter))
+}
+
+// streamWS writes the messages of the subscription as JSON messages until
+// either side closes the connection
+func streamWS(conn *websocket.Conn, subscription *stream.Subscription) {
+	defer subscription.Close()
+
+	// Clients only send pongs and close frames; a client that stops answering
+	// pings misses the read deadline and is disconnected
+	readTimeout := 2 * stream.HeartbeatInterval
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(stream.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				code := websocket.CloseGoingAway
+				if subscription.Err() == stream.ErrSlowClient {
+					code = websocket.CloseTryAgainLater
+				}
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(code, subscription.Err().Error()),
+					time.Now().Add(streamWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"strconv"
+	"time"
 	"tj_techtest/app/models"
+	"tj_techtest/app/services/connectivity"
+	"tj_techtest/app/services/rollup"
 	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -12,12 +17,39 @@ import (
 type VehicleController struct{}
 
 type CreateVehicleRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name                string `json:"name" validate:"required"`
+	OfflineAfterSeconds *int   `json:"offline_after_seconds" validate:"omitempty,min=1"`
 }
 
 var vehicleValidator = validator.New()
 
-// GetVehicles returns all vehicles
+// setConnectivity fills in the connectivity status of the vehicles from their current positions
+func setConnectivity(vehicles []models.Vehicle) error {
+	if len(vehicles) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(vehicles))
+	for i, vehicle := range vehicles {
+		ids[i] = vehicle.ID
+	}
+
+	var positions []models.VehiclePosition
+	if err := config.DB.Where("vehicle_id IN ?", ids).Find(&positions).Error; err != nil {
+		return err
+	}
+	byVehicle := make(map[uint]*models.VehiclePosition, len(positions))
+	for i := range positions {
+		byVehicle[positions[i].VehicleID] = &positions[i]
+	}
+
+	now := time.Now()
+	for i := range vehicles {
+		vehicles[i].Connectivity = connectivity.Status(vehicles[i], byVehicle[vehicles[i].ID], now)
+	}
+	return nil
+}
+
+// GetVehicles returns all vehicles with their connectivity status
 func (c *VehicleController) GetVehicles(ctx *fiber.Ctx) error {
 	var vehicles []models.Vehicle
 	result := config.DB.Find(&vehicles)
@@ -28,6 +60,13 @@ func (c *VehicleController) GetVehicles(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if err := setConnectivity(vehicles); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting vehicle connectivity",
+			"error":   err.Error(),
+		})
+	}
+
 	return ctx.JSON(fiber.Map{
 		"message": "Vehicles retrieved successfully",
 		"data":    vehicles,
@@ -53,7 +92,8 @@ func (c *VehicleController) CreateVehicle(ctx *fiber.Ctx) error {
 	}
 
 	vehicle := models.Vehicle{
-		Name: req.Name,
+		Name:                req.Name,
+		OfflineAfterSeconds: req.OfflineAfterSeconds,
 	}
 
 	result := config.DB.Create(&vehicle)
@@ -70,7 +110,7 @@ func (c *VehicleController) CreateVehicle(ctx *fiber.Ctx) error {
 	})
 }
 
-// GetVehicle returns a specific vehicle
+// GetVehicle returns a specific vehicle with its connectivity status
 func (c *VehicleController) GetVehicle(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 	vehicleID, err := strconv.ParseUint(id, 10, 32)
@@ -88,13 +128,71 @@ func (c *VehicleController) GetVehicle(ctx *fiber.Ctx) error {
 		})
 	}
 
+	vehicles := []models.Vehicle{vehicle}
+	if err := setConnectivity(vehicles); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting vehicle connectivity",
+			"error":   err.Error(),
+		})
+	}
+
 	return ctx.JSON(fiber.Map{
 		"message": "Vehicle retrieved successfully",
+		"data":    vehicles[0],
+	})
+}
+
+// UpdateVehicle updates the name and offline threshold of a vehicle
+func (c *VehicleController) UpdateVehicle(ctx *fiber.Ctx) error {
+	id := ctx.Params("id")
+	vehicleID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid vehicle ID",
+		})
+	}
+
+	var req CreateVehicleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	// Validate request
+	if err := vehicleValidator.Struct(req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	var vehicle models.Vehicle
+	result := config.DB.First(&vehicle, vehicleID)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Vehicle not found",
+		})
+	}
+
+	vehicle.Name = req.Name
+	vehicle.OfflineAfterSeconds = req.OfflineAfterSeconds
+	if err := config.DB.Save(&vehicle).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error updating vehicle",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Vehicle updated successfully",
 		"data":    vehicle,
 	})
 }
 
-// GetVehicleLocations returns location history for a vehicle within a time range
+// GetVehicleLocations returns location history for a vehicle within a time range.
+// Long ranges are served from the minute or hour rollups, see rollup.Resolve.
 func (c *VehicleController) GetVehicleLocations(ctx *fiber.Ctx) error {
 	vehicleID := ctx.Params("id")
 
@@ -113,15 +211,39 @@ func (c *VehicleController) GetVehicleLocations(ctx *fiber.Ctx) error {
 		})
 	}
 
+	var start, end time.Time
+	if startTimestamp > 0 {
+		start = time.Unix(startTimestamp, 0)
+	}
+	if endTimestamp > 0 {
+		end = time.Unix(endTimestamp, 0)
+	}
+
+	resolution := ctx.Query("resolution", rollup.ResolutionAuto)
+	switch resolution {
+	case rollup.ResolutionAuto, rollup.ResolutionRaw, rollup.ResolutionMinute, rollup.ResolutionHour:
+	default:
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid resolution, expected one of auto, raw, minute, hour",
+		})
+	}
+	resolution = rollup.Resolve(resolution, start, end)
+	ctx.Set("X-Resolution", resolution)
+
+	if resolution != rollup.ResolutionRaw {
+		return c.getLocationRollups(ctx, vehicleID, resolution, start, end)
+	}
+
 	// Query builder
 	query := config.DB.Where("vehicle_id = ?", vehicleID)
 
-	// Filter berdasarkan rentang waktu
-	if startTimestamp > 0 {
-		query = query.Where("EXTRACT(EPOCH FROM timestamp) >= ?", startTimestamp)
+	// Filter berdasarkan rentang waktu. Kolom timestamp dibandingkan langsung
+	// (bukan EXTRACT) agar Postgres hanya memindai partisi harian yang relevan
+	if !start.IsZero() {
+		query = query.Where("timestamp >= ?", start)
 	}
-	if endTimestamp > 0 {
-		query = query.Where("EXTRACT(EPOCH FROM timestamp) <= ?", endTimestamp)
+	if !end.IsZero() {
+		query = query.Where("timestamp <= ?", end)
 	}
 
 	// Query dengan sorting berdasarkan timestamp
@@ -137,11 +259,52 @@ func (c *VehicleController) GetVehicleLocations(ctx *fiber.Ctx) error {
 	// Transform response
 	var response []fiber.Map
 	for _, loc := range locations {
+		response = append(response, locationResponse(vehicleID, loc))
+	}
+
+	return ctx.JSON(response)
+}
+
+// getLocationRollups returns one point per minute or hour bucket, positioned at
+// the last location of the bucket
+func (c *VehicleController) getLocationRollups(ctx *fiber.Ctx, vehicleID, resolution string, start, end time.Time) error {
+	query := config.DB.Table(rollup.Table(resolution)).Where("vehicle_id = ?", vehicleID)
+
+	// Bucket yang sebagian berada di dalam rentang tetap disertakan
+	if !start.IsZero() {
+		query = query.Where("bucket >= ?", start.Truncate(rollup.BucketSize(resolution)))
+	}
+	if !end.IsZero() {
+		query = query.Where("bucket <= ?", end)
+	}
+
+	var rollups []models.LocationRollup
+	result := query.Order("bucket ASC").Find(&rollups)
+
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error getting location history",
+		})
+	}
+
+	var response []fiber.Map
+	for _, r := range rollups {
 		response = append(response, fiber.Map{
-			"vehicle_id": vehicleID,
-			"latitude":   loc.Latitude,
-			"longitude":  loc.Longitude,
-			"timestamp":  loc.Timestamp.Unix(),
+			"vehicle_id":  vehicleID,
+			"latitude":    r.Latitude,
+			"longitude":   r.Longitude,
+			"timestamp":   r.LastTimestamp.Unix(),
+			"bucket":      r.Bucket.Unix(),
+			"point_count": r.PointCount,
+			"distance":    r.Distance,
+			"min_speed":   r.MinSpeed,
+			"max_speed":   r.MaxSpeed,
+			"avg_speed":   r.AvgSpeed,
+
+			"heading":            r.Heading,
+			"reported_heading":   r.ReportedHeading,
+			"max_reported_speed": r.MaxReportedSpeed,
+			"avg_reported_speed": r.AvgReportedSpeed,
 		})
 	}
 
@@ -151,11 +314,9 @@ func (c *VehicleController) GetVehicleLocations(ctx *fiber.Ctx) error {
 // GetLastLocation returns the last known location of a vehicle
 func (c *VehicleController) GetLastLocation(ctx *fiber.Ctx) error {
 	vehicleID := ctx.Params("id")
-	var location models.VehicleLocation
+	var position models.VehiclePosition
 
-	result := config.DB.Where("vehicle_id = ?", vehicleID).
-		Order("timestamp DESC").
-		First(&location)
+	result := config.DB.Where("vehicle_id = ?", vehicleID).First(&position)
 
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -163,10 +324,201 @@ func (c *VehicleController) GetLastLocation(ctx *fiber.Ctx) error {
 		})
 	}
 
+	return ctx.JSON(locationResponse(vehicleID, position.Location()))
+}
+
+// GetCurrentLocations returns the current position of every vehicle, optionally
+// limited to a bounding box given by min_lat, min_lon, max_lat and max_lon
+func (c *VehicleController) GetCurrentLocations(ctx *fiber.Ctx) error {
+	// Kendaraan yang sudah dihapus tidak ditampilkan
+	query := config.DB.InnerJoins("Vehicle")
+
+	box, err := parseBoundingBox(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if box != nil {
+		query = query.Where("vehicle_positions.latitude BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+		// Kotak yang melewati garis antimeridian memiliki min_lon > max_lon
+		if box.MinLon <= box.MaxLon {
+			query = query.Where("vehicle_positions.longitude BETWEEN ? AND ?", box.MinLon, box.MaxLon)
+		} else {
+			query = query.Where("(vehicle_positions.longitude >= ? OR vehicle_positions.longitude <= ?)", box.MinLon, box.MaxLon)
+		}
+	}
+
+	var positions []models.VehiclePosition
+	result := query.Order("vehicle_positions.vehicle_id ASC").Find(&positions)
+
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Error getting vehicle locations",
+		})
+	}
+
+	response := []fiber.Map{}
+	for _, position := range positions {
+		location := locationResponse(strconv.FormatUint(uint64(position.VehicleID), 10), position.Location())
+		location["vehicle_name"] = position.Vehicle.Name
+		response = append(response, location)
+	}
+
+	return ctx.JSON(response)
+}
+
+// parseBoundingBox reads the optional min_lat, min_lon, max_lat and max_lon
+// query parameters. It returns nil when none of them is given.
+func parseBoundingBox(ctx *fiber.Ctx) (*geo.Box, error) {
+	bounds := []string{ctx.Query("min_lat"), ctx.Query("min_lon"), ctx.Query("max_lat"), ctx.Query("max_lon")}
+	if bounds[0] == "" && bounds[1] == "" && bounds[2] == "" && bounds[3] == "" {
+		return nil, nil
+	}
+
+	var values [4]float64
+	for i, value := range bounds {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.New("Invalid bounding box, expected numeric min_lat, min_lon, max_lat and max_lon")
+		}
+		values[i] = v
+	}
+
+	box := &geo.Box{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}
+	if box.MinLat > box.MaxLat {
+		return nil, errors.New("Invalid bounding box, min_lat is greater than max_lat")
+	}
+	return box, nil
+}
+
+// locationResponse formats a stored location with its derived and reported motion values
+func locationResponse(vehicleID string, location models.VehicleLocation) fiber.Map {
+	return fiber.Map{
+		"vehicle_id":       vehicleID,
+		"latitude":         location.Latitude,
+		"longitude":        location.Longitude,
+		"timestamp":        location.Timestamp.Unix(),
+		"speed":            location.Speed,
+		"heading":          location.Heading,
+		"distance":         location.Distance,
+		"reported_speed":   location.ReportedSpeed,
+		"reported_heading": location.ReportedHeading,
+		"altitude":         location.Altitude,
+		"accuracy":         location.Accuracy,
+	}
+}
+
+// GetVehicleTrips returns the trips of a vehicle that overlap a time range
+func (c *VehicleController) GetVehicleTrips(ctx *fiber.Ctx) error {
+	vehicleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid vehicle ID",
+		})
+	}
+
+	startTimestamp, err := strconv.ParseInt(ctx.Query("start", "0"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start timestamp",
+		})
+	}
+
+	endTimestamp, err := strconv.ParseInt(ctx.Query("end", "0"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end timestamp",
+		})
+	}
+
+	query := config.DB.Where("vehicle_id = ?", vehicleID)
+
+	// Perjalanan yang sebagian berada di dalam rentang tetap disertakan
+	if startTimestamp > 0 {
+		query = query.Where("end_time >= ?", time.Unix(startTimestamp, 0))
+	}
+	if endTimestamp > 0 {
+		query = query.Where("start_time <= ?", time.Unix(endTimestamp, 0))
+	}
+
+	trips := []models.Trip{}
+	if err := query.Order("start_time ASC").Find(&trips).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting trips",
+			"error":   err.Error(),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{
+		"message": "Trips retrieved successfully",
+		"data":    trips,
+	})
+}
+
+// GetVehicleStops returns the stops of a vehicle that overlap the time range
+func (c *VehicleController) GetVehicleStops(ctx *fiber.Ctx) error {
+	vehicleID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid vehicle ID",
+		})
+	}
+
+	startTimestamp, err := strconv.ParseInt(ctx.Query("start", "0"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start timestamp",
+		})
+	}
+
+	endTimestamp, err := strconv.ParseInt(ctx.Query("end", "0"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end timestamp",
+		})
+	}
+
+	query := config.DB.Preload("Geofence").Where("vehicle_id = ?", vehicleID)
+
+	// Stop yang sebagian berada di dalam rentang tetap disertakan
+	if startTimestamp > 0 {
+		query = query.Where("last_at >= ?", time.Unix(startTimestamp, 0))
+	}
+	if endTimestamp > 0 {
+		query = query.Where("started_at <= ?", time.Unix(endTimestamp, 0))
+	}
+
+	if inside := ctx.Query("inside_geofence"); inside != "" {
+		value, err := strconv.ParseBool(inside)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid inside_geofence",
+			})
+		}
+		query = query.Where("inside_geofence = ?", value)
+	}
+
+	if minDuration := ctx.Query("min_duration"); minDuration != "" {
+		seconds, err := strconv.ParseFloat(minDuration, 64)
+		if err != nil || seconds < 0 {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid min_duration",
+			})
+		}
+		query = query.Where("duration_seconds >= ?", seconds)
+	}
+
+	stops := []models.Stop{}
+	if err := query.Order("started_at ASC").Find(&stops).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error getting stops",
+			"error":   err.Error(),
+		})
+	}
+
 	return ctx.JSON(fiber.Map{
-		"vehicle_id": vehicleID,
-		"latitude":   location.Latitude,
-		"longitude":  location.Longitude,
-		"timestamp":  location.Timestamp.Unix(),
+		"message": "Stops retrieved successfully",
+		"data":    stops,
 	})
 }
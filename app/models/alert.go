@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Alert statuses, an alert moves from open to acknowledged to resolved
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// Alert is a fleet event that a dispatcher has to handle
+type Alert struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	VehicleID       uint       `json:"vehicle_id"`
+	GeofenceID      *uint      `json:"geofence_id"`
+	GeofenceEventID *uint      `json:"geofence_event_id"` // ID di tabel geofence_events
+	RuleID          *uint      `json:"rule_id"`
+	RuleEventID     *uint      `json:"rule_event_id"` // ID di tabel rule_events
+	MessageID       *string    `json:"message_id"`    // ID pesan di fleet.events
+	Event           string     `json:"event" gorm:"not null"`
+	Latitude        float64    `json:"latitude"`
+	Longitude       float64    `json:"longitude"`
+	Timestamp       time.Time  `json:"timestamp"`
+	Status          string     `json:"status" gorm:"not null;default:open"`
+	Assignee        *string    `json:"assignee"`
+	Notes           *string    `json:"notes"`
+	AcknowledgedBy  *string    `json:"acknowledged_by"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at"`
+	ResolvedBy      *string    `json:"resolved_by"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Vehicle  *Vehicle  `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID"`
+	Geofence *Geofence `json:"geofence,omitempty" gorm:"foreignKey:GeofenceID"`
+	Rule     *Rule     `json:"rule,omitempty" gorm:"foreignKey:RuleID"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// GeofenceEvent is a recorded geofence transition of a vehicle
+type GeofenceEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	VehicleID  uint      `json:"vehicle_id"`
+	GeofenceID uint      `json:"geofence_id"`
+	Event      string    `json:"event" gorm:"not null"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Distance   *float64  `json:"distance,omitempty"` // dalam meter, hanya untuk tipe corridor
+	Timestamp  time.Time `json:"timestamp"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	Vehicle  *Vehicle  `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID"`
+	Geofence *Geofence `json:"geofence,omitempty" gorm:"foreignKey:GeofenceID"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	GeofenceTypeCircle   = "circle"
+	GeofenceTypePolygon  = "polygon"
+	GeofenceTypeCorridor = "corridor"
+)
+
+// Geometry is a GeoJSON geometry object stored as JSONB
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Value implements driver.Valuer
+func (g Geometry) Value() (driver.Value, error) {
+	return json.Marshal(g)
+}
+
+// Scan implements sql.Scanner
+func (g *Geometry) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, g)
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	}
+	return errors.New("unsupported geometry value")
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// LocationRollup summarizes the locations of a vehicle within one time bucket.
+// The same shape is stored per minute and per hour.
+type LocationRollup struct {
+	VehicleID     uint      `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	Bucket        time.Time `json:"bucket" gorm:"primaryKey"`
+	Latitude      float64   `json:"latitude"` // posisi terakhir di dalam bucket
+	Longitude     float64   `json:"longitude"`
+	LastTimestamp time.Time `json:"last_timestamp"`
+	PointCount    int       `json:"point_count"`
+	Distance      float64   `json:"distance"`  // dalam meter
+	Duration      float64   `json:"duration"`  // dalam detik
+	MinSpeed      *float64  `json:"min_speed"` // dalam km/jam
+	MaxSpeed      *float64  `json:"max_speed"`
+	AvgSpeed      *float64  `json:"avg_speed"`
+
+	// Heading dari titik terakhir di dalam bucket, kecepatan perangkat dirata-ratakan per titik
+	Heading            *float64 `json:"heading"` // dalam derajat, 0 = utara
+	ReportedHeading    *float64 `json:"reported_heading"`
+	ReportedSpeedCount int      `json:"reported_speed_count"`
+	MaxReportedSpeed   *float64 `json:"max_reported_speed"` // dalam km/jam
+	AvgReportedSpeed   *float64 `json:"avg_reported_speed"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is an event written in the same transaction as the data that
+// produced it and published to RabbitMQ afterwards by the outbox relay
+type OutboxEvent struct {
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	Exchange      string          `json:"exchange" gorm:"not null"`
+	RoutingKey    string          `json:"routing_key"`
+	EventType     string          `json:"event_type" gorm:"not null"`
+	Payload       json.RawMessage `json:"payload" gorm:"type:jsonb;not null"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OverspeedViolation is a period in which a vehicle drove faster than the speed
+// limit of a geofence. It is open while EndedAt is nil.
+type OverspeedViolation struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	VehicleID       uint       `json:"vehicle_id"`
+	GeofenceID      uint       `json:"geofence_id"`
+	SpeedLimit      float64    `json:"speed_limit"` // dalam km/jam
+	PeakSpeed       float64    `json:"peak_speed"`  // dalam km/jam
+	Latitude        float64    `json:"latitude"`    // posisi saat kecepatan puncak
+	Longitude       float64    `json:"longitude"`
+	StartedAt       time.Time  `json:"started_at"`
+	LastAt          time.Time  `json:"last_at"` // titik terakhir yang melebihi batas
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	Notified        bool       `json:"notified"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
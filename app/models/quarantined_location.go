@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// QuarantinedLocation is a location rejected by an ingestion filter, kept for audit.
+// The previous fields hold the last accepted point it was compared against.
+type QuarantinedLocation struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	VehicleID         uint       `json:"vehicle_id"`
+	Latitude          float64    `json:"latitude"`
+	Longitude         float64    `json:"longitude"`
+	Timestamp         time.Time  `json:"timestamp"`
+	Reason            string     `json:"reason" gorm:"not null"`
+	PreviousLatitude  *float64   `json:"previous_latitude"`
+	PreviousLongitude *float64   `json:"previous_longitude"`
+	PreviousTimestamp *time.Time `json:"previous_timestamp"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rule is an operator defined alert condition. Every set condition has to hold
+// for the rule to match; its event is emitted once when it starts matching.
+type Rule struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Name            string         `json:"name" gorm:"not null"`
+	Event           string         `json:"event" gorm:"not null"` // tipe event yang dipublish
+	Enabled         bool           `json:"enabled" gorm:"not null;default:true"`
+	GeofenceID      *uint          `json:"geofence_id"`       // kendaraan berada di dalam geofence
+	StartTime       *string        `json:"start_time"`        // HH:MM waktu lokal
+	EndTime         *string        `json:"end_time"`          // HH:MM waktu lokal
+	SpeedAbove      *float64       `json:"speed_above"`       // dalam km/jam
+	NoUpdateSeconds *int           `json:"no_update_seconds"` // tidak ada lokasi baru selama durasi ini
+	Vehicles        []Vehicle      `json:"vehicles,omitempty" gorm:"many2many:rule_vehicles"`
+	Geofence        *Geofence      `json:"geofence,omitempty" gorm:"foreignKey:GeofenceID"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
+
+// RuleState tracks whether a rule currently matches a vehicle
+type RuleState struct {
+	RuleID    uint       `json:"rule_id" gorm:"primaryKey;autoIncrement:false"`
+	VehicleID uint       `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	Active    bool       `json:"active"`
+	Since     *time.Time `json:"since"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RuleEvent is a recorded event of a rule that started matching a vehicle
+type RuleEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	RuleID     uint      `json:"rule_id"`
+	VehicleID  uint      `json:"vehicle_id"`
+	GeofenceID *uint     `json:"geofence_id"`
+	Event      string    `json:"event" gorm:"not null"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Speed      *float64  `json:"speed"` // dalam km/jam
+	Timestamp  time.Time `json:"timestamp"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	Vehicle *Vehicle `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Stop is a period in which a vehicle stood still longer than the idle
+// threshold. It is ongoing while EndedAt is nil.
+type Stop struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	VehicleID       uint       `json:"vehicle_id" gorm:"not null"`
+	Latitude        float64    `json:"latitude"`
+	Longitude       float64    `json:"longitude"`
+	StartedAt       time.Time  `json:"started_at"`
+	LastAt          time.Time  `json:"last_at"` // titik diam terakhir
+	EndedAt         *time.Time `json:"ended_at"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	InsideGeofence  bool       `json:"inside_geofence"`
+	GeofenceID      *uint      `json:"geofence_id"`
+	Geofence        *Geofence  `json:"geofence,omitempty" gorm:"foreignKey:GeofenceID"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// VehicleStopState is where and since when a vehicle stands still, and its
+// stop once it stood still long enough
+type VehicleStopState struct {
+	VehicleID     uint      `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	StopID        *uint     `json:"stop_id"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	Since         time.Time `json:"since"`
+	LastTimestamp time.Time `json:"last_timestamp"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
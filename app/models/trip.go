@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	TripStatusOpen   = "open"
+	TripStatusClosed = "closed"
+)
+
+// Trip is a period in which a vehicle was moving, between two stops
+type Trip struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	VehicleID      uint      `json:"vehicle_id" gorm:"not null"`
+	Status         string    `json:"status" gorm:"not null;default:open"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	StartLatitude  float64   `json:"start_latitude"`
+	StartLongitude float64   `json:"start_longitude"`
+	EndLatitude    float64   `json:"end_latitude"`
+	EndLongitude   float64   `json:"end_longitude"`
+	Distance       float64   `json:"distance"`  // dalam meter
+	Duration       float64   `json:"duration"`  // dalam detik
+	MaxSpeed       float64   `json:"max_speed"` // dalam km/jam
+	PointCount     int       `json:"point_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// VehicleTripState is the last point seen for a vehicle and its open trip, if any
+type VehicleTripState struct {
+	VehicleID       uint       `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	TripID          *uint      `json:"trip_id"`
+	LastLatitude    float64    `json:"last_latitude"`
+	LastLongitude   float64    `json:"last_longitude"`
+	LastTimestamp   time.Time  `json:"last_timestamp"`
+	StationarySince *time.Time `json:"stationary_since"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -7,11 +7,29 @@ import (
 )
 
 type Vehicle struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Name      string         `json:"name" gorm:"not null"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	Name                string         `json:"name" gorm:"not null"`
+	OfflineAfterSeconds *int           `json:"offline_after_seconds"` // kosong berarti memakai batas default
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+
+	// Diisi oleh endpoint kendaraan, tidak disimpan di tabel vehicles
+	Connectivity *Connectivity `json:"connectivity,omitempty" gorm:"-"`
+}
+
+// Vehicle connectivity statuses
+const (
+	ConnectivityOnline  = "online"
+	ConnectivityOffline = "offline"
+	ConnectivityUnknown = "unknown" // belum pernah mengirim lokasi
+)
+
+// Connectivity tells whether a vehicle is still reporting its location
+type Connectivity struct {
+	Status       string     `json:"status"`
+	LastSeen     *time.Time `json:"last_seen"`
+	OfflineSince *time.Time `json:"offline_since,omitempty"`
 }
 
 type VehicleLocation struct {
@@ -20,16 +38,42 @@ type VehicleLocation struct {
 	Latitude  float64   `json:"latitude"`
 	Longitude float64   `json:"longitude"`
 	Timestamp time.Time `json:"timestamp"`
-	Vehicle   Vehicle   `json:"vehicle" gorm:"foreignKey:VehicleID"`
+
+	// Dihitung terhadap titik sebelumnya, kosong untuk titik pertama kendaraan
+	Speed    *float64 `json:"speed"`    // dalam km/jam
+	Heading  *float64 `json:"heading"`  // dalam derajat, 0 = utara
+	Distance *float64 `json:"distance"` // dalam meter
+
+	// Dikirim oleh perangkat jika tersedia
+	ReportedSpeed   *float64 `json:"reported_speed"`   // dalam km/jam
+	ReportedHeading *float64 `json:"reported_heading"` // dalam derajat
+	Altitude        *float64 `json:"altitude"`         // dalam meter
+	Accuracy        *float64 `json:"accuracy"`         // dalam meter
+
+	Vehicle Vehicle `json:"vehicle" gorm:"foreignKey:VehicleID"`
+}
+
+// CurrentSpeed returns the speed reported by the device, or the derived one
+// when the device didn't report it
+func (l VehicleLocation) CurrentSpeed() *float64 {
+	if l.ReportedSpeed != nil {
+		return l.ReportedSpeed
+	}
+	return l.Speed
 }
 
 type Geofence struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Name      string         `json:"name" gorm:"not null"`
-	Latitude  float64        `json:"latitude"`
-	Longitude float64        `json:"longitude"`
-	Radius    float64        `json:"radius"` // dalam meter
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name" gorm:"not null"`
+	Type       string         `json:"type" gorm:"not null;default:circle"`
+	Latitude   float64        `json:"latitude"`
+	Longitude  float64        `json:"longitude"`
+	Radius     float64        `json:"radius"`                               // dalam meter
+	Geometry   *Geometry      `json:"geometry,omitempty" gorm:"type:jsonb"` // GeoJSON untuk tipe polygon dan corridor
+	Buffer     float64        `json:"buffer,omitempty"`                     // dalam meter, untuk tipe corridor
+	SpeedLimit *float64       `json:"speed_limit"`                          // dalam km/jam, kosong berarti tanpa batas
+	Vehicles   []Vehicle      `json:"vehicles,omitempty" gorm:"many2many:geofence_vehicles"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// VehicleGeofenceState tracks whether a vehicle is currently inside a geofence
+type VehicleGeofenceState struct {
+	VehicleID     uint       `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	GeofenceID    uint       `json:"geofence_id" gorm:"primaryKey;autoIncrement:false"`
+	Inside        bool       `json:"inside"`
+	EnteredAt     *time.Time `json:"entered_at"`
+	DwellNotified bool       `json:"dwell_notified"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// VehiclePosition is the latest location of a vehicle, kept up to date by ingestion
+type VehiclePosition struct {
+	VehicleID uint      `json:"vehicle_id" gorm:"primaryKey;autoIncrement:false"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Speed    *float64 `json:"speed"`    // dalam km/jam
+	Heading  *float64 `json:"heading"`  // dalam derajat, 0 = utara
+	Distance *float64 `json:"distance"` // dalam meter
+
+	ReportedSpeed   *float64 `json:"reported_speed"`   // dalam km/jam
+	ReportedHeading *float64 `json:"reported_heading"` // dalam derajat
+	Altitude        *float64 `json:"altitude"`         // dalam meter
+	Accuracy        *float64 `json:"accuracy"`         // dalam meter
+
+	// Diatur oleh watchdog konektivitas, kembali online saat lokasi baru masuk
+	Offline      bool       `json:"offline"`
+	OfflineSince *time.Time `json:"offline_since"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Vehicle Vehicle `json:"vehicle" gorm:"foreignKey:VehicleID"`
+}
+
+// NewVehiclePosition returns the position of a vehicle at the location
+func NewVehiclePosition(location VehicleLocation) VehiclePosition {
+	return VehiclePosition{
+		VehicleID:       location.VehicleID,
+		Latitude:        location.Latitude,
+		Longitude:       location.Longitude,
+		Timestamp:       location.Timestamp,
+		Speed:           location.Speed,
+		Heading:         location.Heading,
+		Distance:        location.Distance,
+		ReportedSpeed:   location.ReportedSpeed,
+		ReportedHeading: location.ReportedHeading,
+		Altitude:        location.Altitude,
+		Accuracy:        location.Accuracy,
+	}
+}
+
+// Location returns the position as a location of the vehicle
+func (p VehiclePosition) Location() VehicleLocation {
+	return VehicleLocation{
+		VehicleID:       p.VehicleID,
+		Latitude:        p.Latitude,
+		Longitude:       p.Longitude,
+		Timestamp:       p.Timestamp,
+		Speed:           p.Speed,
+		Heading:         p.Heading,
+		Distance:        p.Distance,
+		ReportedSpeed:   p.ReportedSpeed,
+		ReportedHeading: p.ReportedHeading,
+		Altitude:        p.Altitude,
+		Accuracy:        p.Accuracy,
+	}
+}
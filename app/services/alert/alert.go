@@ -0,0 +1,297 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/connectivity"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/app/services/overspeed"
+	"tj_techtest/app/services/stop"
+	"tj_techtest/config"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// foreignKeyViolation is the Postgres error code of a missing referenced row
+const foreignKeyViolation = "23503"
+
+var (
+	// ErrNotFound is returned for an unknown alert ID
+	ErrNotFound = errors.New("alert not found")
+
+	// ErrInvalidTransition is returned when the alert can't move to the requested status
+	ErrInvalidTransition = errors.New("invalid alert status transition")
+
+	// ErrUnknownEvent is returned for a fleet event of a type no alert is built from
+	ErrUnknownEvent = errors.New("unknown event type")
+)
+
+// Events are the event types that open an alert, empty means every type
+var Events = parseEvents(config.GetEnv("ALERT_EVENTS", ""))
+
+func parseEvents(value string) map[string]bool {
+	events := make(map[string]bool)
+	for _, event := range strings.Split(value, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			events[event] = true
+		}
+	}
+	return events
+}
+
+// Wanted reports whether the event type opens an alert
+func Wanted(event string) bool {
+	return len(Events) == 0 || Events[event]
+}
+
+// FromMessage builds the open alert of an event published to fleet.events,
+// decoding the body by its event type. Rule events carry the event type of
+// their rule, so they are recognized by their rule_id.
+func FromMessage(body []byte) (models.Alert, error) {
+	var envelope struct {
+		Event  string `json:"event"`
+		RuleID uint   `json:"rule_id"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return models.Alert{}, err
+	}
+
+	if envelope.RuleID != 0 {
+		var event fleet.RuleEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return models.Alert{}, err
+		}
+		return FromRuleEvent(event)
+	}
+
+	switch envelope.Event {
+	case geofence.EventEntry, geofence.EventExit, geofence.EventDwell,
+		geofence.EventCorridorDeviation, geofence.EventCorridorReturn:
+		var event fleet.GeofenceEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return models.Alert{}, err
+		}
+		return FromGeofenceEvent(event)
+	case connectivity.EventOffline, connectivity.EventOnline:
+		var event fleet.ConnectivityEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return models.Alert{}, err
+		}
+		return FromConnectivityEvent(event)
+	case overspeed.Event, overspeed.EventEnded:
+		var event fleet.OverspeedEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return models.Alert{}, err
+		}
+		return FromOverspeedEvent(event)
+	case stop.Event:
+		var event fleet.IdleEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return models.Alert{}, err
+		}
+		return FromIdleEvent(event)
+	default:
+		return models.Alert{}, fmt.Errorf("%w %q", ErrUnknownEvent, envelope.Event)
+	}
+}
+
+// FromGeofenceEvent builds the open alert of a published geofence event
+func FromGeofenceEvent(event fleet.GeofenceEvent) (models.Alert, error) {
+	alert, err := newAlert(event.VehicleID, event.Event, event.Location.Latitude, event.Location.Longitude, event.Timestamp)
+	if err != nil {
+		return alert, err
+	}
+	if event.GeofenceID != 0 {
+		geofenceID := event.GeofenceID
+		alert.GeofenceID = &geofenceID
+	}
+	if event.ID != 0 {
+		eventID := event.ID
+		alert.GeofenceEventID = &eventID
+	}
+	return alert, nil
+}
+
+// FromRuleEvent builds the open alert of a published rule event
+func FromRuleEvent(event fleet.RuleEvent) (models.Alert, error) {
+	alert, err := newAlert(event.VehicleID, event.Event, event.Location.Latitude, event.Location.Longitude, event.Timestamp)
+	if err != nil {
+		return alert, err
+	}
+	ruleID := event.RuleID
+	alert.RuleID = &ruleID
+	if event.GeofenceID != 0 {
+		geofenceID := event.GeofenceID
+		alert.GeofenceID = &geofenceID
+	}
+	if event.ID != 0 {
+		eventID := event.ID
+		alert.RuleEventID = &eventID
+	}
+	return alert, nil
+}
+
+// FromConnectivityEvent builds the open alert of a vehicle going offline or online
+func FromConnectivityEvent(event fleet.ConnectivityEvent) (models.Alert, error) {
+	return newAlert(event.VehicleID, event.Event, event.Location.Latitude, event.Location.Longitude, event.Timestamp)
+}
+
+// FromOverspeedEvent builds the open alert of a speed limit violation
+func FromOverspeedEvent(event fleet.OverspeedEvent) (models.Alert, error) {
+	alert, err := newAlert(event.VehicleID, event.Event, event.Location.Latitude, event.Location.Longitude, event.Timestamp)
+	if err != nil {
+		return alert, err
+	}
+	geofenceID := event.GeofenceID
+	alert.GeofenceID = &geofenceID
+	return alert, nil
+}
+
+// FromIdleEvent builds the open alert of a vehicle standing still too long
+func FromIdleEvent(event fleet.IdleEvent) (models.Alert, error) {
+	alert, err := newAlert(event.VehicleID, event.Event, event.Location.Latitude, event.Location.Longitude, event.Timestamp)
+	if err != nil {
+		return alert, err
+	}
+	if event.GeofenceID != 0 {
+		geofenceID := event.GeofenceID
+		alert.GeofenceID = &geofenceID
+	}
+	return alert, nil
+}
+
+func newAlert(vehicle, event string, lat, lon float64, timestamp int64) (models.Alert, error) {
+	vehicleID, err := strconv.ParseUint(vehicle, 10, 32)
+	if err != nil {
+		return models.Alert{}, err
+	}
+	if event == "" {
+		return models.Alert{}, errors.New("event type is missing")
+	}
+	return models.Alert{
+		VehicleID: uint(vehicleID),
+		Event:     event,
+		Latitude:  lat,
+		Longitude: lon,
+		Timestamp: time.Unix(timestamp, 0),
+		Status:    models.AlertStatusOpen,
+	}, nil
+}
+
+// Create stores the alert. An event delivered more than once opens a single
+// alert, and no alert is opened for a vehicle or geofence deleted in the
+// meantime; created reports whether the alert is new.
+func Create(db *gorm.DB, alert *models.Alert) (created bool, err error) {
+	// Conflicts on message_id, geofence_event_id or rule_event_id
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+
+	var pgErr *pgconn.PgError
+	if errors.As(result.Error, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return false, nil
+	}
+	return result.RowsAffected > 0, result.Error
+}
+
+// Store opens an alert for a fleet event received from geofence_alerts so
+// dispatchers can handle it. Invalid events and event types that don't open an
+// alert are skipped; an error means the event must be delivered again.
+func Store(ctx context.Context, messageID string, body []byte) error {
+	log.Printf("Received fleet event: %s", body)
+
+	a, err := FromMessage(body)
+	if err != nil {
+		log.Printf("Invalid fleet event, no alert opened: %v", err)
+		return nil
+	}
+	if !Wanted(a.Event) {
+		return nil
+	}
+	if messageID != "" {
+		a.MessageID = &messageID
+	}
+
+	created, err := Create(config.DB.WithContext(ctx), &a)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Opened alert %d for %s of vehicle %d", a.ID, a.Event, a.VehicleID)
+	}
+	return nil
+}
+
+// Acknowledge marks an open alert as being handled by user. The alert is
+// assigned to assignee, or to user when assignee is empty.
+func Acknowledge(db *gorm.DB, id uint, user, assignee, notes string) (models.Alert, error) {
+	if assignee == "" {
+		assignee = user
+	}
+	return transition(db, id, func(alert *models.Alert, now time.Time) error {
+		if alert.Status != models.AlertStatusOpen {
+			return ErrInvalidTransition
+		}
+		alert.Status = models.AlertStatusAcknowledged
+		alert.Assignee = &assignee
+		alert.AcknowledgedBy = &user
+		alert.AcknowledgedAt = &now
+		addNotes(alert, user, notes, now)
+		return nil
+	})
+}
+
+// Resolve closes an open or acknowledged alert
+func Resolve(db *gorm.DB, id uint, user, notes string) (models.Alert, error) {
+	return transition(db, id, func(alert *models.Alert, now time.Time) error {
+		if alert.Status == models.AlertStatusResolved {
+			return ErrInvalidTransition
+		}
+		alert.Status = models.AlertStatusResolved
+		alert.ResolvedBy = &user
+		alert.ResolvedAt = &now
+		addNotes(alert, user, notes, now)
+		return nil
+	})
+}
+
+// transition applies change to the locked alert and saves it
+func transition(db *gorm.DB, id uint, change func(alert *models.Alert, now time.Time) error) (models.Alert, error) {
+	var alert models.Alert
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&alert, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := change(&alert, time.Now()); err != nil {
+			return err
+		}
+		return tx.Save(&alert).Error
+	})
+	return alert, err
+}
+
+// addNotes appends the notes of a status change so earlier notes stay in the audit trail
+func addNotes(alert *models.Alert, user, notes string, now time.Time) {
+	if notes == "" {
+		return
+	}
+	// Format: [waktu] user: catatan, satu baris per perubahan status
+	line := "[" + now.UTC().Format(time.RFC3339) + "] " + user + ": " + notes
+	if alert.Notes != nil && *alert.Notes != "" {
+		line = *alert.Notes + "\n" + line
+	}
+	alert.Notes = &line
+}
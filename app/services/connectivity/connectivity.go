@@ -0,0 +1,156 @@
+package connectivity
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/config"
+	"tj_techtest/pkg/rabbitmq"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventOffline = "vehicle_offline"
+	EventOnline  = "vehicle_online"
+)
+
+var (
+	// OfflineAfter is how long a vehicle without its own threshold may stay
+	// silent before it is considered offline
+	OfflineAfter = config.GetDuration("VEHICLE_OFFLINE_AFTER", 5*time.Minute)
+
+	// CheckInterval is how often the watchdog looks for vehicles that stopped reporting
+	CheckInterval = config.GetDuration("CONNECTIVITY_CHECK_INTERVAL", 30*time.Second)
+)
+
+// Threshold returns how long the vehicle may stay silent before it is offline
+func Threshold(vehicle models.Vehicle) time.Duration {
+	if vehicle.OfflineAfterSeconds != nil {
+		return time.Duration(*vehicle.OfflineAfterSeconds) * time.Second
+	}
+	return OfflineAfter
+}
+
+// Status returns the connectivity of the vehicle from its current position,
+// which is nil if the vehicle never reported. A vehicle past its threshold is
+// offline even before the watchdog marked it.
+func Status(vehicle models.Vehicle, position *models.VehiclePosition, now time.Time) *models.Connectivity {
+	if position == nil {
+		return &models.Connectivity{Status: models.ConnectivityUnknown}
+	}
+
+	lastSeen := position.Timestamp
+	status := &models.Connectivity{Status: models.ConnectivityOnline, LastSeen: &lastSeen}
+	if position.Offline {
+		status.Status = models.ConnectivityOffline
+		status.OfflineSince = position.OfflineSince
+	} else if since := lastSeen.Add(Threshold(vehicle)); now.After(since) {
+		status.Status = models.ConnectivityOffline
+		status.OfflineSince = &since
+	}
+	return status
+}
+
+// Online marks an offline vehicle online again after it sent a location newer
+// than its current position and enqueues a vehicle_online event.
+// It runs after position.Update, so the watchdog already sees the new timestamp
+// and doesn't mark the vehicle offline again.
+func Online(tx *gorm.DB, vehicle models.Vehicle, location models.VehicleLocation) error {
+	var previous []struct {
+		OfflineSince *time.Time
+	}
+	err := tx.Raw(`
+		UPDATE vehicle_positions p SET offline = FALSE, offline_since = NULL
+		FROM (SELECT vehicle_id, offline_since FROM vehicle_positions WHERE vehicle_id = ? FOR UPDATE) old
+		WHERE p.vehicle_id = old.vehicle_id AND p.offline
+		RETURNING old.offline_since`, vehicle.ID).Scan(&previous).Error
+	if err != nil || len(previous) == 0 {
+		return err
+	}
+
+	log.Printf("Vehicle %s is back online", vehicle.Name)
+	event := fleet.NewConnectivityEvent(vehicle, EventOnline, location.Latitude, location.Longitude, location.Timestamp)
+	if previous[0].OfflineSince != nil {
+		event.OfflineSince = previous[0].OfflineSince.Unix()
+	}
+	if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", EventOnline, event); err != nil {
+		return fmt.Errorf("enqueueing connectivity event: %w", err)
+	}
+	return nil
+}
+
+// Run marks vehicles that stopped reporting as offline every CheckInterval
+// until ctx is canceled. Several instances may run at once, a vehicle goes
+// offline only once.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	log.Printf("Connectivity watchdog started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Connectivity watchdog stopped")
+			return
+		case <-ticker.C:
+			if err := checkOffline(time.Now()); err != nil {
+				log.Printf("Connectivity watchdog error: %v", err)
+			}
+		}
+	}
+}
+
+// checkOffline finds the online vehicles whose latest position is older than
+// their threshold and marks them offline one at a time
+func checkOffline(now time.Time) error {
+	var positions []models.VehiclePosition
+	err := config.DB.InnerJoins("Vehicle").
+		Where("NOT vehicle_positions.offline").
+		Where("vehicle_positions.timestamp < ?::timestamptz - make_interval(secs => COALESCE(\"Vehicle\".offline_after_seconds, ?))",
+			now, OfflineAfter.Seconds()).
+		Find(&positions).Error
+	if err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		if err := markOffline(position.Vehicle, now); err != nil {
+			log.Printf("Failed to mark vehicle %d offline: %v", position.VehicleID, err)
+		}
+	}
+	return nil
+}
+
+// markOffline marks the vehicle offline, dated at the moment it passed its
+// threshold, and enqueues a vehicle_offline event unless a new location
+// arrived in the meantime
+func markOffline(vehicle models.Vehicle, now time.Time) error {
+	threshold := Threshold(vehicle)
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var marked []models.VehiclePosition
+		err := tx.Raw(`
+			UPDATE vehicle_positions SET offline = TRUE, offline_since = timestamp + make_interval(secs => ?)
+			WHERE vehicle_id = ? AND NOT offline AND timestamp < ?
+			RETURNING vehicle_id, latitude, longitude, timestamp, offline_since`,
+			threshold.Seconds(), vehicle.ID, now.Add(-threshold)).Scan(&marked).Error
+		if err != nil || len(marked) == 0 {
+			return err
+		}
+		position := marked[0]
+
+		log.Printf("Vehicle %s is offline, last seen at %v", vehicle.Name, position.Timestamp)
+		event := fleet.NewConnectivityEvent(vehicle, EventOffline, position.Latitude, position.Longitude, *position.OfflineSince)
+		event.LastSeen = position.Timestamp.Unix()
+		event.OfflineSince = position.OfflineSince.Unix()
+		if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", EventOffline, event); err != nil {
+			return fmt.Errorf("enqueueing connectivity event: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,279 @@
+package geofence
+
+import (
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	EventEntry = "geofence_entry"
+	EventExit  = "geofence_exit"
+	EventDwell = "geofence_dwell"
+
+	EventCorridorDeviation = "corridor_deviation"
+	EventCorridorReturn    = "corridor_return"
+)
+
+// DwellThreshold is how long a vehicle has to stay inside a geofence before a dwell event is emitted
+var DwellThreshold = config.GetDuration("GEOFENCE_DWELL_THRESHOLD", 5*time.Minute)
+
+// Transition is a change in a vehicle's membership of a geofence
+type Transition struct {
+	Event     string
+	VehicleID uint
+	Geofence  models.Geofence
+	Latitude  float64
+	Longitude float64
+	Timestamp time.Time
+	Distance  float64 // jarak ke garis koridor dalam meter, hanya untuk tipe corridor
+	EventID   uint    // ID baris di geofence_events setelah dicatat
+}
+
+// Evaluate checks the location against all geofences, updates the persisted
+// membership state of the vehicle, records the transitions that occurred in the
+// event history and returns them.
+// A vehicle that stays inside a geofence only produces an entry once, followed
+// by a single dwell event after DwellThreshold and an exit when it leaves.
+// The vehicle row stays locked until tx ends, so the next point of the vehicle
+// is evaluated against the state left by this one.
+func Evaluate(tx *gorm.DB, location models.VehicleLocation) ([]Transition, error) {
+	index, err := CurrentIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the vehicle row so concurrent consumers evaluate its points one at a time
+	if err := lockVehicle(tx, location.VehicleID); err != nil {
+		return nil, err
+	}
+
+	var states []models.VehicleGeofenceState
+	if err := tx.Where("vehicle_id = ?", location.VehicleID).Find(&states).Error; err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(index, states)
+	transitions := e.apply(location)
+
+	if changed := e.changedStates(); len(changed) > 0 {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&changed).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := record(tx, transitions); err != nil {
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+func lockVehicle(tx *gorm.DB, vehicleID uint) error {
+	var vehicle models.Vehicle
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, vehicleID).Error
+}
+
+// record appends transitions to the event history and sets their EventID
+func record(tx *gorm.DB, transitions []Transition) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+
+	events := make([]models.GeofenceEvent, len(transitions))
+	for i, transition := range transitions {
+		events[i] = models.GeofenceEvent{
+			VehicleID:  transition.VehicleID,
+			GeofenceID: transition.Geofence.ID,
+			Event:      transition.Event,
+			Latitude:   transition.Latitude,
+			Longitude:  transition.Longitude,
+			Timestamp:  transition.Timestamp,
+		}
+		if transition.Geofence.Type == models.GeofenceTypeCorridor {
+			distance := transition.Distance
+			events[i].Distance = &distance
+		}
+	}
+	if err := tx.Create(&events).Error; err != nil {
+		return err
+	}
+	for i := range transitions {
+		transitions[i].EventID = events[i].ID
+	}
+	return nil
+}
+
+// evaluator applies the points of one vehicle to its membership states in memory
+type evaluator struct {
+	index   *Index
+	order   []uint // geofence IDs in the order their states were added
+	states  map[uint]models.VehicleGeofenceState
+	changed map[uint]bool
+}
+
+func newEvaluator(index *Index, states []models.VehicleGeofenceState) *evaluator {
+	e := &evaluator{
+		index:   index,
+		states:  make(map[uint]models.VehicleGeofenceState, len(states)),
+		changed: make(map[uint]bool),
+	}
+	for _, state := range states {
+		e.set(state)
+	}
+	return e
+}
+
+func (e *evaluator) set(state models.VehicleGeofenceState) {
+	if _, ok := e.states[state.GeofenceID]; !ok {
+		e.order = append(e.order, state.GeofenceID)
+	}
+	e.states[state.GeofenceID] = state
+}
+
+// apply evaluates a single point and returns the transitions it caused
+func (e *evaluator) apply(location models.VehicleLocation) []Transition {
+	var transitions []Transition
+
+	// Geofences near the point, plus the ones the vehicle is currently inside so exits are detected
+	candidates := e.index.Candidates(location.Latitude, location.Longitude, location.VehicleID)
+	for _, id := range e.order {
+		if !e.states[id].Inside {
+			continue
+		}
+		if entry, ok := e.index.Get(id); ok && !containsEntry(candidates, entry) && entry.AppliesTo(location.VehicleID) {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	for _, entry := range candidates {
+		geofence := entry.Geofence
+		state, known := e.states[geofence.ID]
+
+		var (
+			event    string
+			next     models.VehicleGeofenceState
+			ok       bool
+			distance float64
+		)
+		if geofence.Type == models.GeofenceTypeCorridor {
+			distance = entry.Distance(location.Latitude, location.Longitude)
+			inside := distance <= geofence.Buffer
+			event, next, ok = stepCorridor(state, known, inside, entry.Assigned(), location.Timestamp)
+		} else {
+			inside := entry.Contains(location.Latitude, location.Longitude)
+			event, next, ok = step(state, known, inside, location.Timestamp)
+		}
+		if !ok {
+			continue
+		}
+
+		next.VehicleID = location.VehicleID
+		next.GeofenceID = geofence.ID
+		e.set(next)
+		e.changed[geofence.ID] = true
+
+		if event != "" {
+			transitions = append(transitions, Transition{
+				Event:     event,
+				VehicleID: location.VehicleID,
+				Geofence:  geofence,
+				Latitude:  location.Latitude,
+				Longitude: location.Longitude,
+				Timestamp: location.Timestamp,
+				Distance:  distance,
+			})
+		}
+	}
+
+	return transitions
+}
+
+// changedStates returns the states modified by apply
+func (e *evaluator) changedStates() []models.VehicleGeofenceState {
+	var changed []models.VehicleGeofenceState
+	for _, id := range e.order {
+		if e.changed[id] {
+			changed = append(changed, e.states[id])
+		}
+	}
+	return changed
+}
+
+func containsEntry(entries []*Entry, entry *Entry) bool {
+	for _, e := range entries {
+		if e.Geofence.ID == entry.Geofence.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// step applies a single observation to the membership state. It returns the
+// event to emit (if any), the new state and whether the state must be saved.
+func step(state models.VehicleGeofenceState, known, inside bool, at time.Time) (string, models.VehicleGeofenceState, bool) {
+	wasInside := known && state.Inside
+
+	switch {
+	case inside && !wasInside:
+		enteredAt := at
+		state.Inside = true
+		state.EnteredAt = &enteredAt
+		state.DwellNotified = false
+		state.LastSeenAt = at
+		return EventEntry, state, true
+
+	case inside && wasInside:
+		state.LastSeenAt = at
+		if !state.DwellNotified && state.EnteredAt != nil && at.Sub(*state.EnteredAt) >= DwellThreshold {
+			state.DwellNotified = true
+			return EventDwell, state, true
+		}
+		return "", state, true
+
+	case !inside && wasInside:
+		state.Inside = false
+		state.EnteredAt = nil
+		state.DwellNotified = false
+		state.LastSeenAt = at
+		return EventExit, state, true
+	}
+
+	// Outside and never (or no longer) inside: nothing to record
+	return "", state, false
+}
+
+// stepCorridor applies a single observation to a corridor state. Leaving the
+// buffer emits a deviation and coming back emits a return. A vehicle assigned
+// to the corridor that is first seen outside of it is reported as deviating.
+func stepCorridor(state models.VehicleGeofenceState, known, inside, assigned bool, at time.Time) (string, models.VehicleGeofenceState, bool) {
+	wasInside := known && state.Inside
+	state.LastSeenAt = at
+
+	switch {
+	case inside && !wasInside:
+		enteredAt := at
+		state.Inside = true
+		state.EnteredAt = &enteredAt
+		if known {
+			return EventCorridorReturn, state, true
+		}
+		return "", state, true
+
+	case inside && wasInside:
+		return "", state, true
+
+	case !inside && wasInside:
+		state.Inside = false
+		state.EnteredAt = nil
+		return EventCorridorDeviation, state, true
+
+	case !inside && !known && assigned:
+		state.Inside = false
+		return EventCorridorDeviation, state, true
+	}
+
+	return "", state, false
+}
@@ -0,0 +1,241 @@
+package geofence
+
+import (
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+)
+
+func TestStep(t *testing.T) {
+	entered := time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC)
+	inside := models.VehicleGeofenceState{Inside: true, EnteredAt: &entered, LastSeenAt: entered}
+	dwelled := inside
+	dwelled.DwellNotified = true
+	outside := models.VehicleGeofenceState{Inside: false, LastSeenAt: entered}
+
+	tests := []struct {
+		name       string
+		state      models.VehicleGeofenceState
+		known      bool
+		inside     bool
+		at         time.Time
+		wantEvent  string
+		wantInside bool
+		wantSave   bool
+	}{
+		{"first point inside", models.VehicleGeofenceState{}, false, true, entered, EventEntry, true, true},
+		{"first point outside", models.VehicleGeofenceState{}, false, false, entered, "", false, false},
+		{"re-entry", outside, true, true, entered.Add(time.Minute), EventEntry, true, true},
+		{"stays outside", outside, true, false, entered.Add(time.Minute), "", false, false},
+		{"stays inside", inside, true, true, entered.Add(time.Minute), "", true, true},
+		{"dwell threshold reached", inside, true, true, entered.Add(DwellThreshold), EventDwell, true, true},
+		{"dwell already notified", dwelled, true, true, entered.Add(2 * DwellThreshold), "", true, true},
+		{"exit", inside, true, false, entered.Add(time.Minute), EventExit, false, true},
+		{"exit after dwell", dwelled, true, false, entered.Add(2 * DwellThreshold), EventExit, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, next, save := step(tt.state, tt.known, tt.inside, tt.at)
+			if event != tt.wantEvent {
+				t.Errorf("event = %q, want %q", event, tt.wantEvent)
+			}
+			if save != tt.wantSave {
+				t.Errorf("save = %v, want %v", save, tt.wantSave)
+			}
+			if !save {
+				return
+			}
+			if next.Inside != tt.wantInside {
+				t.Errorf("inside = %v, want %v", next.Inside, tt.wantInside)
+			}
+			if !next.LastSeenAt.Equal(tt.at) {
+				t.Errorf("last seen = %v, want %v", next.LastSeenAt, tt.at)
+			}
+			if next.Inside != (next.EnteredAt != nil) {
+				t.Errorf("entered at = %v for inside = %v", next.EnteredAt, next.Inside)
+			}
+			if tt.wantEvent == EventEntry && next.DwellNotified {
+				t.Errorf("dwell still notified after a new entry")
+			}
+		})
+	}
+}
+
+func TestEvaluatorCircle(t *testing.T) {
+	index := NewIndex(DefaultCellSize)
+	circle := models.Geofence{ID: 1, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 100}
+	if err := index.Set(circle); err != nil {
+		t.Fatal(err)
+	}
+
+	// ~11 m dan ~1,1 km dari pusat geofence
+	arrival := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	in := func(at time.Time) models.VehicleLocation {
+		return models.VehicleLocation{VehicleID: 7, Latitude: -6.2001, Longitude: 106.8, Timestamp: at}
+	}
+	out := func(at time.Time) models.VehicleLocation {
+		return models.VehicleLocation{VehicleID: 7, Latitude: -6.21, Longitude: 106.8, Timestamp: at}
+	}
+
+	tests := []struct {
+		name   string
+		points []models.VehicleLocation
+		want   []string
+	}{
+		{"never inside", []models.VehicleLocation{out(arrival), out(arrival.Add(time.Minute))}, nil},
+		{"single entry for repeated pings", []models.VehicleLocation{in(arrival), in(arrival.Add(time.Second)), in(arrival.Add(2 * time.Second))}, []string{EventEntry}},
+		{"entry and exit", []models.VehicleLocation{out(arrival), in(arrival.Add(time.Minute)), out(arrival.Add(2 * time.Minute))}, []string{EventEntry, EventExit}},
+		{
+			"dwell once",
+			[]models.VehicleLocation{in(arrival), in(arrival.Add(DwellThreshold)), in(arrival.Add(2 * DwellThreshold)), out(arrival.Add(3 * DwellThreshold))},
+			[]string{EventEntry, EventDwell, EventExit},
+		},
+		{
+			"dwell resets on re-entry",
+			[]models.VehicleLocation{in(arrival), in(arrival.Add(DwellThreshold)), out(arrival.Add(DwellThreshold + time.Minute)), in(arrival.Add(DwellThreshold + 2*time.Minute)), in(arrival.Add(2*DwellThreshold + 2*time.Minute))},
+			[]string{EventEntry, EventDwell, EventExit, EventEntry, EventDwell},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEvaluator(index, nil)
+			var got []string
+			for _, point := range tt.points {
+				for _, transition := range e.apply(point) {
+					if transition.Geofence.ID != circle.ID || transition.VehicleID != 7 {
+						t.Errorf("transition for geofence %d, vehicle %d", transition.Geofence.ID, transition.VehicleID)
+					}
+					got = append(got, transition.Event)
+				}
+			}
+			assertEvents(t, got, tt.want)
+		})
+	}
+}
+
+func TestEvaluatorResumesFromStoredState(t *testing.T) {
+	index := NewIndex(DefaultCellSize)
+	if err := index.Set(models.Geofence{ID: 1, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	entered := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	stored := []models.VehicleGeofenceState{{VehicleID: 7, GeofenceID: 1, Inside: true, EnteredAt: &entered, LastSeenAt: entered}}
+	e := newEvaluator(index, stored)
+
+	// Titik jauh di luar sel grid geofence tetap menghasilkan exit
+	transitions := e.apply(models.VehicleLocation{VehicleID: 7, Latitude: -7, Longitude: 110, Timestamp: entered.Add(time.Minute)})
+	if len(transitions) != 1 || transitions[0].Event != EventExit {
+		t.Fatalf("transitions = %+v, want a single exit", transitions)
+	}
+
+	changed := e.changedStates()
+	if len(changed) != 1 || changed[0].Inside {
+		t.Errorf("changed states = %+v, want one state outside", changed)
+	}
+}
+
+func TestStepCorridor(t *testing.T) {
+	lastSeen := time.Date(2024, 3, 4, 6, 15, 0, 0, time.UTC)
+	inside := models.VehicleGeofenceState{Inside: true, LastSeenAt: lastSeen}
+	deviating := models.VehicleGeofenceState{Inside: false, LastSeenAt: lastSeen}
+	at := lastSeen.Add(time.Minute)
+
+	tests := []struct {
+		name       string
+		state      models.VehicleGeofenceState
+		known      bool
+		inside     bool
+		assigned   bool
+		wantEvent  string
+		wantInside bool
+		wantSave   bool
+	}{
+		{"first point inside", models.VehicleGeofenceState{}, false, true, false, "", true, true},
+		{"first point outside", models.VehicleGeofenceState{}, false, false, false, "", false, false},
+		{"assigned vehicle first seen outside", models.VehicleGeofenceState{}, false, false, true, EventCorridorDeviation, false, true},
+		{"stays inside", inside, true, true, false, "", true, true},
+		{"leaves buffer", inside, true, false, false, EventCorridorDeviation, false, true},
+		{"keeps deviating", deviating, true, false, true, "", false, false},
+		{"returns", deviating, true, true, false, EventCorridorReturn, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, next, save := stepCorridor(tt.state, tt.known, tt.inside, tt.assigned, at)
+			if event != tt.wantEvent {
+				t.Errorf("event = %q, want %q", event, tt.wantEvent)
+			}
+			if save != tt.wantSave {
+				t.Errorf("save = %v, want %v", save, tt.wantSave)
+			}
+			if save && next.Inside != tt.wantInside {
+				t.Errorf("inside = %v, want %v", next.Inside, tt.wantInside)
+			}
+		})
+	}
+}
+
+func TestEvaluatorCorridor(t *testing.T) {
+	index := NewIndex(DefaultCellSize)
+	corridor := models.Geofence{
+		ID:       2,
+		Type:     models.GeofenceTypeCorridor,
+		Geometry: &models.Geometry{Type: "LineString", Coordinates: []byte(`[[106.80,-6.20],[106.85,-6.20]]`)},
+		Buffer:   50,
+		Vehicles: []models.Vehicle{{ID: 7}},
+	}
+	if err := index.Set(corridor); err != nil {
+		t.Fatal(err)
+	}
+
+	// ~11 m dan ~110 m dari garis koridor
+	departure := time.Date(2024, 3, 4, 6, 0, 0, 0, time.UTC)
+	on := func(at time.Time, vehicleID uint) models.VehicleLocation {
+		return models.VehicleLocation{VehicleID: vehicleID, Latitude: -6.2001, Longitude: 106.82, Timestamp: at}
+	}
+	off := func(at time.Time, vehicleID uint) models.VehicleLocation {
+		return models.VehicleLocation{VehicleID: vehicleID, Latitude: -6.201, Longitude: 106.82, Timestamp: at}
+	}
+
+	tests := []struct {
+		name   string
+		points []models.VehicleLocation
+		want   []string
+	}{
+		{"stays on route", []models.VehicleLocation{on(departure, 7), on(departure.Add(time.Minute), 7)}, nil},
+		{"deviation and return", []models.VehicleLocation{on(departure, 7), off(departure.Add(time.Minute), 7), off(departure.Add(2*time.Minute), 7), on(departure.Add(3*time.Minute), 7)}, []string{EventCorridorDeviation, EventCorridorReturn}},
+		{"assigned vehicle starts off route", []models.VehicleLocation{off(departure, 7), on(departure.Add(time.Minute), 7)}, []string{EventCorridorDeviation, EventCorridorReturn}},
+		{"unassigned vehicle is ignored", []models.VehicleLocation{on(departure, 8), off(departure.Add(time.Minute), 8)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEvaluator(index, nil)
+			var got []string
+			for _, point := range tt.points {
+				for _, transition := range e.apply(point) {
+					if transition.Event == EventCorridorDeviation && transition.Distance <= corridor.Buffer {
+						t.Errorf("deviation reported %.1f m from the line, buffer %.0f m", transition.Distance, corridor.Buffer)
+					}
+					got = append(got, transition.Event)
+				}
+			}
+			assertEvents(t, got, tt.want)
+		})
+	}
+}
+
+func assertEvents(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+}
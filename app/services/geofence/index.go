@@ -0,0 +1,370 @@
+package geofence
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultCellSize is the grid cell size in degrees (~1.1 km at the equator)
+	DefaultCellSize = 0.01
+
+	// maxCellsPerGeofence keeps very large geofences out of the grid; they are checked for every point instead
+	maxCellsPerGeofence = 4096
+
+	metersPerDegree = 111320.0
+)
+
+// IndexRefreshInterval is how often the in-memory index is fully reloaded from the
+// database, so changes made by other processes are eventually picked up
+var IndexRefreshInterval = config.GetDuration("GEOFENCE_INDEX_REFRESH", time.Minute)
+
+type cell struct {
+	x, y int32
+}
+
+// Entry is an indexed geofence with its shape parsed once
+type Entry struct {
+	Geofence models.Geofence
+
+	shape    geo.MultiPolygon
+	line     geo.LineString
+	vehicles map[uint]bool
+	cells    []cell
+}
+
+// NewEntry parses the geofence geometry for indexing
+func NewEntry(geofence models.Geofence) (*Entry, error) {
+	entry := &Entry{Geofence: geofence}
+
+	switch geofence.Type {
+	case models.GeofenceTypePolygon, models.GeofenceTypeCorridor:
+		if geofence.Geometry == nil {
+			return nil, errors.New("geofence has no geometry")
+		}
+		var err error
+		if geofence.Type == models.GeofenceTypePolygon {
+			entry.shape, err = geo.ParseGeoJSON(geofence.Geometry.Type, geofence.Geometry.Coordinates)
+		} else {
+			entry.line, err = geo.ParseLineString(geofence.Geometry.Type, geofence.Geometry.Coordinates)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(geofence.Vehicles) > 0 {
+		entry.vehicles = make(map[uint]bool, len(geofence.Vehicles))
+		for _, vehicle := range geofence.Vehicles {
+			entry.vehicles[vehicle.ID] = true
+		}
+	}
+	return entry, nil
+}
+
+// Contains reports whether the point lies inside the geofence
+func (e *Entry) Contains(lat, lon float64) bool {
+	switch e.Geofence.Type {
+	case models.GeofenceTypePolygon:
+		return e.shape.Contains(lat, lon)
+	case models.GeofenceTypeCorridor:
+		return e.Distance(lat, lon) <= e.Geofence.Buffer
+	default:
+		return geo.Distance(lat, lon, e.Geofence.Latitude, e.Geofence.Longitude) <= e.Geofence.Radius
+	}
+}
+
+// Distance returns the distance in meters from the point to the corridor line
+func (e *Entry) Distance(lat, lon float64) float64 {
+	if len(e.line) == 0 {
+		return math.Inf(1)
+	}
+	return e.line.DistanceTo(lat, lon)
+}
+
+// Assigned reports whether the geofence is restricted to a set of vehicles
+func (e *Entry) Assigned() bool {
+	return len(e.vehicles) > 0
+}
+
+// AppliesTo reports whether the geofence is evaluated for the vehicle. Geofences
+// without assigned vehicles apply to the whole fleet.
+func (e *Entry) AppliesTo(vehicleID uint) bool {
+	return len(e.vehicles) == 0 || e.vehicles[vehicleID]
+}
+
+// bounds returns the bounding box of the geofence in degrees
+func (e *Entry) bounds() (minLat, minLon, maxLat, maxLon float64) {
+	minLat, minLon = math.Inf(1), math.Inf(1)
+	maxLat, maxLon = math.Inf(-1), math.Inf(-1)
+	extend := func(p geo.Position) {
+		minLon, maxLon = math.Min(minLon, p[0]), math.Max(maxLon, p[0])
+		minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+	}
+
+	var margin float64
+	switch e.Geofence.Type {
+	case models.GeofenceTypePolygon:
+		for _, polygon := range e.shape {
+			for _, p := range polygon[0] {
+				extend(p)
+			}
+		}
+	case models.GeofenceTypeCorridor:
+		for _, p := range e.line {
+			extend(p)
+		}
+		margin = e.Geofence.Buffer
+	default:
+		extend(geo.Position{e.Geofence.Longitude, e.Geofence.Latitude})
+		margin = e.Geofence.Radius
+	}
+
+	latMargin := margin / metersPerDegree
+	lonMargin := margin / (metersPerDegree * math.Max(math.Cos(maxAbs(minLat, maxLat)*math.Pi/180), 0.01))
+	return minLat - latMargin, minLon - lonMargin, maxLat + latMargin, maxLon + lonMargin
+}
+
+func maxAbs(a, b float64) float64 {
+	return math.Max(math.Abs(a), math.Abs(b))
+}
+
+// Index is a uniform grid over latitude/longitude used to find the geofences
+// that may contain a point without checking every geofence
+type Index struct {
+	mu        sync.RWMutex
+	cellSize  float64
+	entries   map[uint]*Entry
+	grid      map[cell][]*Entry
+	global    map[uint]*Entry
+	byVehicle map[uint]map[uint]*Entry
+}
+
+// NewIndex creates an empty index with the given cell size in degrees
+func NewIndex(cellSize float64) *Index {
+	return &Index{
+		cellSize:  cellSize,
+		entries:   make(map[uint]*Entry),
+		grid:      make(map[cell][]*Entry),
+		global:    make(map[uint]*Entry),
+		byVehicle: make(map[uint]map[uint]*Entry),
+	}
+}
+
+// Set adds or replaces a geofence in the index
+func (i *Index) Set(geofence models.Geofence) error {
+	entry, err := NewEntry(geofence)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(geofence.ID)
+	i.entries[geofence.ID] = entry
+
+	for vehicleID := range entry.vehicles {
+		if i.byVehicle[vehicleID] == nil {
+			i.byVehicle[vehicleID] = make(map[uint]*Entry)
+		}
+		i.byVehicle[vehicleID][geofence.ID] = entry
+	}
+
+	minLat, minLon, maxLat, maxLon := entry.bounds()
+	x0, y0 := i.cellOf(minLat, minLon)
+	x1, y1 := i.cellOf(maxLat, maxLon)
+	if maxLon-minLon >= 180 || int64(x1-x0+1)*int64(y1-y0+1) > maxCellsPerGeofence {
+		i.global[geofence.ID] = entry
+		return nil
+	}
+
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			c := cell{x, y}
+			i.grid[c] = append(i.grid[c], entry)
+			entry.cells = append(entry.cells, c)
+		}
+	}
+	return nil
+}
+
+// Remove deletes a geofence from the index
+func (i *Index) Remove(id uint) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(id)
+}
+
+func (i *Index) remove(id uint) {
+	entry, ok := i.entries[id]
+	if !ok {
+		return
+	}
+	delete(i.entries, id)
+	delete(i.global, id)
+
+	for vehicleID := range entry.vehicles {
+		delete(i.byVehicle[vehicleID], id)
+		if len(i.byVehicle[vehicleID]) == 0 {
+			delete(i.byVehicle, vehicleID)
+		}
+	}
+
+	for _, c := range entry.cells {
+		list := i.grid[c]
+		for k, e := range list {
+			if e == entry {
+				list = append(list[:k:k], list[k+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(i.grid, c)
+		} else {
+			i.grid[c] = list
+		}
+	}
+}
+
+// Get returns the indexed geofence with the given ID
+func (i *Index) Get(id uint) (*Entry, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	entry, ok := i.entries[id]
+	return entry, ok
+}
+
+// Len returns the number of indexed geofences
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.entries)
+}
+
+// Candidates returns the geofences applicable to the vehicle that may contain the
+// point, plus every geofence the vehicle is assigned to
+func (i *Index) Candidates(lat, lon float64, vehicleID uint) []*Entry {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var candidates []*Entry
+	seen := make(map[uint]bool)
+	add := func(entry *Entry) {
+		if seen[entry.Geofence.ID] || !entry.AppliesTo(vehicleID) {
+			return
+		}
+		seen[entry.Geofence.ID] = true
+		candidates = append(candidates, entry)
+	}
+
+	x, y := i.cellOf(lat, lon)
+	for _, entry := range i.grid[cell{x, y}] {
+		add(entry)
+	}
+	for _, entry := range i.global {
+		add(entry)
+	}
+	for _, entry := range i.byVehicle[vehicleID] {
+		add(entry)
+	}
+	return candidates
+}
+
+// Locate returns the geofences applicable to the vehicle that contain the point
+func (i *Index) Locate(lat, lon float64, vehicleID uint) []*Entry {
+	var matches []*Entry
+	for _, entry := range i.Candidates(lat, lon, vehicleID) {
+		if entry.Contains(lat, lon) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+func (i *Index) cellOf(lat, lon float64) (int32, int32) {
+	return int32(math.Floor(lon / i.cellSize)), int32(math.Floor(lat / i.cellSize))
+}
+
+var (
+	indexMu       sync.Mutex
+	defaultIndex  *Index
+	indexLoadedAt time.Time
+)
+
+// LoadIndex builds an index from every geofence in the database
+func LoadIndex(db *gorm.DB) (*Index, error) {
+	var geofences []models.Geofence
+	if err := db.Preload("Vehicles").Find(&geofences).Error; err != nil {
+		return nil, err
+	}
+
+	index := NewIndex(DefaultCellSize)
+	for _, geofence := range geofences {
+		if err := index.Set(geofence); err != nil {
+			log.Printf("Skipping geofence %d in index: %v", geofence.ID, err)
+		}
+	}
+	return index, nil
+}
+
+// CurrentIndex returns the shared index, loading it on first use and
+// reloading it once IndexRefreshInterval has passed
+func CurrentIndex() (*Index, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	if defaultIndex != nil && time.Since(indexLoadedAt) < IndexRefreshInterval {
+		return defaultIndex, nil
+	}
+
+	index, err := LoadIndex(config.DB)
+	if err != nil {
+		if defaultIndex != nil {
+			log.Printf("Failed to refresh geofence index, using previous one: %v", err)
+			return defaultIndex, nil
+		}
+		return nil, err
+	}
+
+	defaultIndex = index
+	indexLoadedAt = time.Now()
+	log.Printf("Loaded %d geofences into index", index.Len())
+	return defaultIndex, nil
+}
+
+// ReloadGeofence refreshes a single geofence in the shared index after it was
+// created, updated or deleted
+func ReloadGeofence(id uint) error {
+	indexMu.Lock()
+	index := defaultIndex
+	indexMu.Unlock()
+
+	// Not loaded yet; the first CurrentIndex call will pick up the change
+	if index == nil {
+		return nil
+	}
+
+	var geofence models.Geofence
+	err := config.DB.Preload("Vehicles").First(&geofence, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		index.Remove(id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := index.Set(geofence); err != nil {
+		index.Remove(id)
+		return err
+	}
+	return nil
+}
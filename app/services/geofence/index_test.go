@@ -0,0 +1,158 @@
+package geofence
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"tj_techtest/app/models"
+)
+
+// Area acak di sekitar Jakarta untuk test dan benchmark index
+const (
+	minLat, maxLat = -6.40, -6.05
+	minLon, maxLon = 106.65, 107.05
+)
+
+func randomGeofence(rng *rand.Rand, id uint) models.Geofence {
+	lat := randomBetween(rng, minLat, maxLat)
+	lon := randomBetween(rng, minLon, maxLon)
+
+	if id%2 == 0 {
+		return models.Geofence{
+			ID:        id,
+			Type:      models.GeofenceTypeCircle,
+			Latitude:  lat,
+			Longitude: lon,
+			Radius:    randomBetween(rng, 50, 500),
+		}
+	}
+
+	d := randomBetween(rng, 0.001, 0.005)
+	ring := [][2]float64{{lon, lat}, {lon + d, lat}, {lon + d, lat + d}, {lon, lat + d}, {lon, lat}}
+	coordinates, _ := json.Marshal([][][2]float64{ring})
+	return models.Geofence{
+		ID:       id,
+		Type:     models.GeofenceTypePolygon,
+		Geometry: &models.Geometry{Type: "Polygon", Coordinates: coordinates},
+	}
+}
+
+func randomBetween(rng *rand.Rand, min, max float64) float64 {
+	return min + rng.Float64()*(max-min)
+}
+
+// buildIndex indexes count random geofences and also returns them as entries for linear scans
+func buildIndex(tb testing.TB, count int) (*Index, []*Entry) {
+	tb.Helper()
+	rng := rand.New(rand.NewSource(1))
+
+	index := NewIndex(DefaultCellSize)
+	entries := make([]*Entry, 0, count)
+	for id := 1; id <= count; id++ {
+		g := randomGeofence(rng, uint(id))
+		if err := index.Set(g); err != nil {
+			tb.Fatalf("failed to index geofence %d: %v", id, err)
+		}
+		entry, err := NewEntry(g)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return index, entries
+}
+
+func randomPoints(count int) [][2]float64 {
+	rng := rand.New(rand.NewSource(2))
+	points := make([][2]float64, count)
+	for i := range points {
+		points[i] = [2]float64{randomBetween(rng, minLat, maxLat), randomBetween(rng, minLon, maxLon)}
+	}
+	return points
+}
+
+func TestIndexLocateMatchesLinearScan(t *testing.T) {
+	index, entries := buildIndex(t, 2000)
+
+	for _, p := range randomPoints(5000) {
+		want := make(map[uint]bool)
+		for _, entry := range entries {
+			if entry.Contains(p[0], p[1]) {
+				want[entry.Geofence.ID] = true
+			}
+		}
+
+		got := index.Locate(p[0], p[1], 1)
+		if len(got) != len(want) {
+			t.Fatalf("Locate(%v, %v) found %d geofences, linear scan %d", p[0], p[1], len(got), len(want))
+		}
+		for _, entry := range got {
+			if !want[entry.Geofence.ID] {
+				t.Fatalf("Locate(%v, %v) returned geofence %d not containing the point", p[0], p[1], entry.Geofence.ID)
+			}
+		}
+	}
+}
+
+func TestIndexVehicleAssignment(t *testing.T) {
+	index := NewIndex(DefaultCellSize)
+	shared := models.Geofence{ID: 1, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 100}
+	assigned := models.Geofence{ID: 2, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 100, Vehicles: []models.Vehicle{{ID: 7}}}
+	for _, g := range []models.Geofence{shared, assigned} {
+		if err := index.Set(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		vehicleID uint
+		want      int
+	}{
+		{"assigned vehicle", 7, 2},
+		{"other vehicle", 8, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := index.Locate(-6.2, 106.8, tt.vehicleID); len(got) != tt.want {
+				t.Errorf("Locate() found %d geofences, want %d", len(got), tt.want)
+			}
+		})
+	}
+
+	index.Remove(2)
+	if got := index.Locate(-6.2, 106.8, 7); len(got) != 1 || got[0].Geofence.ID != 1 {
+		t.Errorf("Locate() after Remove = %d geofences, want only geofence 1", len(got))
+	}
+}
+
+// Benchmark biaya evaluasi geofence per pesan lokasi dengan 10.000 geofence,
+// membandingkan spatial index (grid) dengan pengecekan linear ke semua geofence:
+//
+//	go test ./app/services/geofence -run '^$' -bench Locate -benchmem
+func BenchmarkLocateIndexed(b *testing.B) {
+	index, _ := buildIndex(b, 10000)
+	points := randomPoints(1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := points[i%len(points)]
+		index.Locate(p[0], p[1], 1)
+	}
+}
+
+func BenchmarkLocateLinear(b *testing.B) {
+	_, entries := buildIndex(b, 10000)
+	points := randomPoints(1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := points[i%len(points)]
+		for _, entry := range entries {
+			entry.Contains(p[0], p[1])
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package geofence
+
+import (
+	"log"
+	"time"
+	"tj_techtest/app/models"
+
+	"gorm.io/gorm"
+)
+
+// retractedBy is recorded as the user that resolved the alert of a retracted event
+const retractedBy = "system"
+
+// Replay re-evaluates every stored point of a vehicle from the given time on
+// in timestamp order, after late points were inserted before its latest point.
+// The membership state at from is rebuilt from the last point and the event
+// history before it and the state of the vehicle is replaced by the replayed
+// one. Events recorded since from that occur again keep their ID, so alerts
+// stay linked to them; events that no longer occur are retracted and their
+// alerts resolved. It returns the transitions that were not recorded before the replay.
+// The points are read with tx, so the late points must have been inserted with it.
+func Replay(tx *gorm.DB, vehicleID uint, from time.Time) ([]Transition, error) {
+	index, err := CurrentIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockVehicle(tx, vehicleID); err != nil {
+		return nil, err
+	}
+
+	var previous []models.GeofenceEvent
+	if err := tx.Where("vehicle_id = ? AND timestamp >= ?", vehicleID, from).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	states, err := statesAt(tx, index, vehicleID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []models.VehicleLocation
+	err = tx.Select("vehicle_id", "latitude", "longitude", "timestamp").
+		Where("vehicle_id = ? AND timestamp >= ?", vehicleID, from).
+		Order("timestamp ASC, id ASC").
+		Find(&points).Error
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(index, states)
+	var transitions []Transition
+	for _, point := range points {
+		transitions = append(transitions, e.apply(point)...)
+	}
+
+	if err := tx.Where("vehicle_id = ?", vehicleID).Delete(&models.VehicleGeofenceState{}).Error; err != nil {
+		return nil, err
+	}
+	if replayed := e.allStates(); len(replayed) > 0 {
+		if err := tx.Create(&replayed).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Events that were already recorded are not recorded or emitted again
+	recorded := make(map[eventKey][]uint, len(previous))
+	for _, event := range previous {
+		key := eventKey{event.GeofenceID, event.Event, event.Timestamp.UnixNano()}
+		recorded[key] = append(recorded[key], event.ID)
+	}
+	var fresh []Transition
+	for _, transition := range transitions {
+		key := eventKey{transition.Geofence.ID, transition.Event, transition.Timestamp.UnixNano()}
+		if ids := recorded[key]; len(ids) > 0 {
+			recorded[key] = ids[1:]
+			continue
+		}
+		fresh = append(fresh, transition)
+	}
+
+	var retracted []uint
+	for _, ids := range recorded {
+		retracted = append(retracted, ids...)
+	}
+	if len(retracted) > 0 {
+		if err := retract(tx, retracted); err != nil {
+			return nil, err
+		}
+		log.Printf("Geofence replay of vehicle %d since %v retracted %d events", vehicleID, from, len(retracted))
+	}
+
+	if err := record(tx, fresh); err != nil {
+		return nil, err
+	}
+
+	return fresh, nil
+}
+
+// retract resolves the unresolved alerts of events that no longer occur and
+// deletes the events
+func retract(tx *gorm.DB, ids []uint) error {
+	now := time.Now()
+	// Format catatan sama dengan alert.addNotes
+	note := "[" + now.UTC().Format(time.RFC3339) + "] " + retractedBy + ": event retracted after late points were replayed"
+	err := tx.Model(&models.Alert{}).
+		Where("geofence_event_id IN ? AND status <> ?", ids, models.AlertStatusResolved).
+		Updates(map[string]interface{}{
+			"status":      models.AlertStatusResolved,
+			"resolved_by": retractedBy,
+			"resolved_at": now,
+			"notes":       gorm.Expr("CASE WHEN notes IS NULL OR notes = '' THEN ? ELSE notes || E'\\n' || ? END", note, note),
+		}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&models.GeofenceEvent{}, ids).Error
+}
+
+// eventKey identifies an event of a vehicle, geofence_events is unique on it
+type eventKey struct {
+	geofenceID uint
+	event      string
+	timestamp  int64
+}
+
+// statesAt rebuilds the membership states of a vehicle just before at. Whether
+// the vehicle was inside a geofence follows from its last point before at, when
+// it entered and whether a dwell was emitted follow from the event history.
+func statesAt(tx *gorm.DB, index *Index, vehicleID uint, at time.Time) ([]models.VehicleGeofenceState, error) {
+	// Last event and last entry of every geofence before at
+	var lastEvents, lastEntries []models.GeofenceEvent
+	err := tx.Raw(`
+		SELECT DISTINCT ON (geofence_id) * FROM geofence_events
+		WHERE vehicle_id = ? AND timestamp < ?
+		ORDER BY geofence_id, timestamp DESC, id DESC`, vehicleID, at).Scan(&lastEvents).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Raw(`
+		SELECT DISTINCT ON (geofence_id) * FROM geofence_events
+		WHERE vehicle_id = ? AND timestamp < ? AND event IN (?, ?)
+		ORDER BY geofence_id, timestamp DESC, id DESC`, vehicleID, at, EventEntry, EventCorridorReturn).Scan(&lastEntries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var last []models.VehicleLocation
+	err = tx.Select("latitude", "longitude", "timestamp").
+		Where("vehicle_id = ? AND timestamp < ?", vehicleID, at).
+		Order("timestamp DESC").
+		Limit(1).
+		Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lastEvent := make(map[uint]models.GeofenceEvent, len(lastEvents))
+	for _, event := range lastEvents {
+		lastEvent[event.GeofenceID] = event
+	}
+	lastEntry := make(map[uint]models.GeofenceEvent, len(lastEntries))
+	for _, event := range lastEntries {
+		lastEntry[event.GeofenceID] = event
+	}
+
+	var states []models.VehicleGeofenceState
+	inside := make(map[uint]bool)
+	if len(last) > 0 {
+		point := last[0]
+		for _, entry := range index.Locate(point.Latitude, point.Longitude, vehicleID) {
+			state := models.VehicleGeofenceState{
+				VehicleID:  vehicleID,
+				GeofenceID: entry.Geofence.ID,
+				Inside:     true,
+				LastSeenAt: point.Timestamp,
+			}
+
+			enteredAt := point.Timestamp
+			event, ok := lastEvent[entry.Geofence.ID]
+			if ok && event.Event != EventExit && event.Event != EventCorridorDeviation {
+				if entered, ok := lastEntry[entry.Geofence.ID]; ok {
+					enteredAt = entered.Timestamp
+				}
+				state.DwellNotified = event.Event == EventDwell
+			}
+			state.EnteredAt = &enteredAt
+
+			states = append(states, state)
+			inside[entry.Geofence.ID] = true
+		}
+	}
+
+	// Geofences the vehicle left before at are still known, so coming back to a corridor is a return
+	for _, event := range lastEvents {
+		if inside[event.GeofenceID] {
+			continue
+		}
+		states = append(states, models.VehicleGeofenceState{
+			VehicleID:  vehicleID,
+			GeofenceID: event.GeofenceID,
+			LastSeenAt: event.Timestamp,
+		})
+	}
+
+	return states, nil
+}
+
+// allStates returns every state held by the evaluator
+func (e *evaluator) allStates() []models.VehicleGeofenceState {
+	states := make([]models.VehicleGeofenceState, 0, len(e.order))
+	for _, id := range e.order {
+		states = append(states, e.states[id])
+	}
+	return states
+}
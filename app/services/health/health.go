@@ -0,0 +1,53 @@
+package health
+
+import (
+	"sort"
+	"sync"
+)
+
+// Check returns an error when a dependency is unhealthy
+type Check func() error
+
+// Result is the outcome of a single check
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var (
+	mu     sync.RWMutex
+	checks = make(map[string]Check)
+)
+
+// Register adds or replaces a named health check
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Run executes every registered check and reports whether all of them passed
+func Run() ([]Result, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	healthy := true
+	results := make([]Result, 0, len(names))
+	for _, name := range names {
+		result := Result{Name: name, Status: "up"}
+		if err := checks[name](); err != nil {
+			result.Status = "down"
+			result.Error = err.Error()
+			healthy = false
+		}
+		results = append(results, result)
+	}
+	return results, healthy
+}
@@ -0,0 +1,517 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/connectivity"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/app/services/overspeed"
+	"tj_techtest/app/services/position"
+	"tj_techtest/app/services/rollup"
+	"tj_techtest/app/services/rule"
+	"tj_techtest/app/services/stop"
+	"tj_techtest/app/services/stream"
+	"tj_techtest/app/services/trip"
+	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
+	"tj_techtest/pkg/rabbitmq"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// insertChunk keeps multi-row inserts well below the Postgres parameter limit
+const insertChunk = 1000
+
+var (
+	// ErrPipelineStopped is returned for locations submitted after the pipeline was stopped
+	ErrPipelineStopped = errors.New("ingestion pipeline stopped")
+
+	// BatchSize is the maximum number of locations written in one transaction
+	BatchSize = config.GetInt("INGEST_BATCH_SIZE", 500)
+
+	// FlushInterval is the longest a location waits before a partial batch is written
+	FlushInterval = config.GetDuration("INGEST_FLUSH_INTERVAL", 100*time.Millisecond)
+)
+
+// pending is a resolved location waiting for the next flush
+type pending struct {
+	vehicle  models.Vehicle
+	location models.VehicleLocation
+	late     bool // older than the latest stored point of the vehicle
+	result   chan error
+}
+
+// Run writes submitted locations in batches until ctx is canceled, then
+// flushes what is left. Locations are written once BatchSize are queued or
+// FlushInterval has passed, whichever comes first.
+func (p *Pipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*pending, 0, p.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			// Write what was queued before the pipeline stopped
+			for {
+				select {
+				case item := <-p.queue:
+					batch = append(batch, item)
+				default:
+					p.flush(batch)
+					close(p.stopped)
+					return
+				}
+			}
+		case item := <-p.queue:
+			batch = append(batch, item)
+			if len(batch) >= p.batchSize {
+				p.flush(batch)
+				batch = make([]*pending, 0, p.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]*pending, 0, p.batchSize)
+			}
+		}
+	}
+}
+
+// submit queues a location and waits until it has been written. It blocks
+// while the queue is full, which holds back the consumers feeding the pipeline.
+func (p *Pipeline) submit(ctx context.Context, vehicle models.Vehicle, location models.VehicleLocation) error {
+	item := &pending{
+		vehicle:  vehicle,
+		location: location,
+		result:   make(chan error, 1),
+	}
+
+	select {
+	case p.queue <- item:
+	case <-p.stopped:
+		return ErrPipelineStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-item.result:
+		return err
+	case <-p.stopped:
+		// The final flush may have written the item just before stopping
+		select {
+		case err := <-item.result:
+			return err
+		default:
+			return ErrPipelineStopped
+		}
+	}
+}
+
+// flush writes the batch in one transaction. If a row was rejected by the
+// database every location is retried on its own, so a single bad row doesn't
+// fail the whole batch; other failures, e.g. a lost connection, fail the whole
+// batch at once instead of being repeated for every location.
+func (p *Pipeline) flush(batch []*pending) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := p.writeLocations(batch)
+	if err == nil {
+		log.Printf("Processed %d locations", len(batch))
+		for _, item := range batch {
+			item.result <- nil
+		}
+		return
+	}
+
+	if len(batch) == 1 {
+		batch[0].result <- err
+		return
+	}
+
+	if !isDataError(err) {
+		log.Printf("Failed to save batch of %d locations: %v", len(batch), err)
+		for _, item := range batch {
+			item.result <- err
+		}
+		return
+	}
+
+	log.Printf("Failed to save batch of %d locations, retrying individually: %v", len(batch), err)
+	for _, item := range batch {
+		item.result <- p.writeLocations([]*pending{item})
+	}
+}
+
+// isDataError reports whether the database rejected the data itself: a data
+// exception (class 22) or an integrity constraint violation (class 23)
+func isDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
+
+// writeLocations filters the locations, quarantines the rejected ones and
+// inserts the rest, updates the current positions, notifies stream clients,
+// evaluates geofences, rules, speed limits and stops, enqueues the resulting
+// events and extends the trips in a single transaction. The services called
+// here keep their state and write their events to the outbox with tx, so a
+// batch that fails leaves nothing behind and is written again as a whole.
+func (p *Pipeline) writeLocations(batch []*pending) error {
+	// Geofence evaluation locks vehicle rows; a fixed order avoids deadlocks
+	// between concurrent writers, and points of a vehicle are evaluated in time order
+	sort.SliceStable(batch, func(i, j int) bool {
+		a, b := batch[i].location, batch[j].location
+		if a.VehicleID != b.VehicleID {
+			return a.VehicleID < b.VehicleID
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+
+	var notifications stream.Batch
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		accepted, quarantined, err := p.screen(batch, storedPoints(tx))
+		if err != nil {
+			return fmt.Errorf("filtering locations: %w", err)
+		}
+
+		if len(quarantined) > 0 {
+			if err := tx.CreateInBatches(&quarantined, insertChunk).Error; err != nil {
+				return fmt.Errorf("quarantining locations: %w", err)
+			}
+		}
+		if len(accepted) == 0 {
+			return nil
+		}
+
+		locations := make([]models.VehicleLocation, len(accepted))
+		for i, item := range accepted {
+			locations[i] = item.location
+		}
+
+		if err := tx.CreateInBatches(&locations, insertChunk).Error; err != nil {
+			return fmt.Errorf("saving locations: %w", err)
+		}
+		if err := rollup.MarkDirty(tx, locations); err != nil {
+			return fmt.Errorf("marking rollups: %w", err)
+		}
+		if err := position.Update(tx, locations); err != nil {
+			return fmt.Errorf("updating positions: %w", err)
+		}
+
+		// Delivered to live stream clients once the transaction commits
+		messages := make([]stream.Location, len(accepted))
+		for i, item := range accepted {
+			messages[i] = stream.NewLocation(item.vehicle, locations[i], item.late)
+		}
+		if err := notifications.AddLocations(messages); err != nil {
+			return fmt.Errorf("notifying location stream: %w", err)
+		}
+
+		// Locations are grouped by vehicle, late points first
+		for start := 0; start < len(locations); {
+			end := start + 1
+			for end < len(locations) && locations[end].VehicleID == locations[start].VehicleID {
+				end++
+			}
+			if err := p.evaluate(tx, &notifications, accepted[start:end], locations[start:end]); err != nil {
+				return err
+			}
+			if err := trip.Track(tx, locations[start].VehicleID, locations[start:end]); err != nil {
+				return fmt.Errorf("tracking trips: %w", err)
+			}
+			start = end
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The locations are stored, a stream that misses them doesn't fail the batch
+	if err := notifications.Send(config.DB); err != nil {
+		log.Printf("Failed to notify streams: %v", err)
+	}
+	return nil
+}
+
+// evaluate runs geofence evaluation, the alert rules, the speed limits and
+// idle detection for the inserted locations of one vehicle, brings an offline
+// vehicle back online and enqueues the resulting events. Late points replay
+// the geofence evaluation of the vehicle from the oldest of them, so events are
+// recorded in timestamp order; rules, speed limits, stops and connectivity
+// only see points newer than the latest stored one. Geofence events are added
+// to notifications for the event streams.
+func (p *Pipeline) evaluate(tx *gorm.DB, notifications *stream.Batch, items []*pending, locations []models.VehicleLocation) error {
+	vehicle := items[0].vehicle
+
+	if items[0].late {
+		if err := relink(tx, items, locations); err != nil {
+			return fmt.Errorf("updating motion after late points: %w", err)
+		}
+
+		// The replay also covers the newer points of the batch
+		transitions, err := geofence.Replay(tx, vehicle.ID, locations[0].Timestamp)
+		if err != nil {
+			return fmt.Errorf("replaying geofences: %w", err)
+		}
+		if err := enqueueTransitions(tx, notifications, vehicle, transitions); err != nil {
+			return err
+		}
+	} else {
+		for _, location := range locations {
+			transitions, err := geofence.Evaluate(tx, location)
+			if err != nil {
+				return fmt.Errorf("evaluating geofences: %w", err)
+			}
+			if err := enqueueTransitions(tx, notifications, vehicle, transitions); err != nil {
+				return err
+			}
+		}
+	}
+
+	var current []models.VehicleLocation
+	for i, item := range items {
+		if !item.late {
+			current = append(current, locations[i])
+		}
+	}
+	if err := rule.Evaluate(tx, vehicle, current); err != nil {
+		return fmt.Errorf("evaluating rules: %w", err)
+	}
+	if err := overspeed.Evaluate(tx, vehicle, current); err != nil {
+		return fmt.Errorf("evaluating speed limits: %w", err)
+	}
+	if err := stop.Track(tx, vehicle, current); err != nil {
+		return fmt.Errorf("tracking stops: %w", err)
+	}
+	if len(current) > 0 {
+		if err := connectivity.Online(tx, vehicle, current[len(current)-1]); err != nil {
+			return fmt.Errorf("updating connectivity: %w", err)
+		}
+	}
+	return nil
+}
+
+// enqueueTransitions publishes geofence events through the outbox and adds them to the live event streams
+func enqueueTransitions(tx *gorm.DB, notifications *stream.Batch, vehicle models.Vehicle, transitions []geofence.Transition) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+
+	events := make([]fleet.GeofenceEvent, len(transitions))
+	for i, transition := range transitions {
+		log.Printf("Vehicle %s %s geofence %s", vehicle.Name, transition.Event, transition.Geofence.Name)
+
+		events[i] = fleet.NewGeofenceEvent(vehicle, transition)
+		if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", transition.Event, events[i]); err != nil {
+			return fmt.Errorf("enqueueing geofence event: %w", err)
+		}
+	}
+
+	if err := notifications.AddGeofenceEvents(events); err != nil {
+		return fmt.Errorf("notifying geofence event stream: %w", err)
+	}
+	return nil
+}
+
+// relink derives the motion of the stored points that directly follow a late
+// point again, since their previous point is now the late one
+func relink(tx *gorm.DB, items []*pending, locations []models.VehicleLocation) error {
+	inserted := make(map[uint]bool, len(locations))
+	for _, location := range locations {
+		inserted[location.ID] = true
+	}
+
+	for i := 0; i < len(items) && items[i].late; i++ {
+		late := locations[i]
+
+		var next []models.VehicleLocation
+		err := tx.Where("vehicle_id = ? AND timestamp > ?", late.VehicleID, late.Timestamp).
+			Order("timestamp ASC").
+			Limit(1).
+			Find(&next).Error
+		if err != nil {
+			return err
+		}
+		// A following point of the same batch was already derived against it
+		if len(next) == 0 || inserted[next[0].ID] {
+			continue
+		}
+
+		following := next[0]
+		following.Speed, following.Heading, following.Distance = nil, nil, nil
+		deriveMotion(&following, &late)
+		err = tx.Model(&models.VehicleLocation{}).
+			Where("id = ? AND timestamp = ?", following.ID, following.Timestamp).
+			Updates(map[string]interface{}{
+				"speed":    following.Speed,
+				"heading":  following.Heading,
+				"distance": following.Distance,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if err := position.UpdateMotion(tx, following); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// screen runs the filters against the previous point of each location and
+// derives the motion of the accepted locations. A location with the timestamp
+// of the latest point of its vehicle or of a location accepted earlier in the
+// batch is a duplicate. A location older than the latest point of its vehicle
+// is accepted as late if it is within MaxLateness, and compared against the
+// point right before it. Batch must be sorted by vehicle and time.
+func (p *Pipeline) screen(batch []*pending, storedPoint pointLookup) ([]*pending, []models.QuarantinedLocation, error) {
+	var (
+		accepted    []*pending
+		quarantined []models.QuarantinedLocation
+		latest      *models.VehicleLocation // latest accepted point of the vehicle
+		lastLate    *models.VehicleLocation // latest late point accepted from this batch
+		lastBatch   *models.VehicleLocation // last point of the vehicle accepted from this batch
+	)
+
+	for i, item := range batch {
+		location := &item.location
+		item.late = false
+
+		if i == 0 || batch[i-1].location.VehicleID != location.VehicleID {
+			// The latest stored point of the vehicle, which may be older than the batch
+			stored, err := storedPoint(location.VehicleID, time.Time{})
+			if err != nil {
+				return nil, nil, err
+			}
+			latest, lastLate, lastBatch = stored, nil, nil
+		}
+
+		// Points accepted from this batch aren't stored yet, so storedPoint can't find them
+		if duplicate := sameTimestamp(*location, latest, lastBatch); duplicate != nil {
+			log.Printf("Quarantined location of vehicle %s at %v: %s", item.vehicle.Name, location.Timestamp, ReasonDuplicateTimestamp)
+			quarantined = append(quarantined, quarantine(*location, duplicate, ReasonDuplicateTimestamp))
+			continue
+		}
+
+		previous := latest
+		if latest != nil && !location.Timestamp.After(latest.Timestamp) {
+			if latest.Timestamp.Sub(location.Timestamp) > MaxLateness {
+				log.Printf("Quarantined location of vehicle %s at %v: %s", item.vehicle.Name, location.Timestamp, ReasonOutOfOrder)
+				quarantined = append(quarantined, quarantine(*location, latest, ReasonOutOfOrder))
+				continue
+			}
+
+			stored, err := storedPoint(location.VehicleID, location.Timestamp)
+			if err != nil {
+				return nil, nil, err
+			}
+			previous = stored
+			if lastLate != nil && (previous == nil || !lastLate.Timestamp.Before(previous.Timestamp)) {
+				previous = lastLate
+			}
+			item.late = true
+		}
+
+		if reason := p.check(*location, previous); reason != "" {
+			log.Printf("Quarantined location of vehicle %s at %v: %s", item.vehicle.Name, location.Timestamp, reason)
+			quarantined = append(quarantined, quarantine(*location, previous, reason))
+			continue
+		}
+
+		deriveMotion(location, previous)
+		accepted = append(accepted, item)
+		lastBatch = location
+		if item.late {
+			lastLate = location
+		} else {
+			latest = location
+		}
+	}
+
+	return accepted, quarantined, nil
+}
+
+// sameTimestamp returns the first of the points recorded at the time of the location, if any
+func sameTimestamp(location models.VehicleLocation, points ...*models.VehicleLocation) *models.VehicleLocation {
+	for _, point := range points {
+		if point != nil && location.Timestamp.Equal(point.Timestamp) {
+			return point
+		}
+	}
+	return nil
+}
+
+// pointLookup returns the latest stored point of the vehicle at or before the
+// given time, or its latest point when the time is zero
+type pointLookup func(vehicleID uint, at time.Time) (*models.VehicleLocation, error)
+
+// storedPoints looks points up in vehicle_locations
+func storedPoints(tx *gorm.DB) pointLookup {
+	return func(vehicleID uint, at time.Time) (*models.VehicleLocation, error) {
+		query := tx.Select("vehicle_id", "latitude", "longitude", "timestamp").Where("vehicle_id = ?", vehicleID)
+		if !at.IsZero() {
+			query = query.Where("timestamp <= ?", at)
+		}
+
+		var stored []models.VehicleLocation
+		if err := query.Order("timestamp DESC").Limit(1).Find(&stored).Error; err != nil {
+			return nil, err
+		}
+		if len(stored) == 0 {
+			return nil, nil
+		}
+		return &stored[0], nil
+	}
+}
+
+func quarantine(location models.VehicleLocation, previous *models.VehicleLocation, reason string) models.QuarantinedLocation {
+	q := models.QuarantinedLocation{
+		VehicleID: location.VehicleID,
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Timestamp: location.Timestamp,
+		Reason:    reason,
+	}
+	if previous != nil {
+		q.PreviousLatitude = &previous.Latitude
+		q.PreviousLongitude = &previous.Longitude
+		q.PreviousTimestamp = &previous.Timestamp
+	}
+	return q
+}
+
+// deriveMotion sets the speed, heading and distance of the location against
+// the previous point of the vehicle
+func deriveMotion(location *models.VehicleLocation, previous *models.VehicleLocation) {
+	if previous == nil {
+		return
+	}
+
+	distance := geo.Distance(previous.Latitude, previous.Longitude, location.Latitude, location.Longitude)
+	location.Distance = &distance
+
+	if elapsed := location.Timestamp.Sub(previous.Timestamp).Seconds(); elapsed > 0 {
+		speed := distance / elapsed * 3.6 // km/jam
+		location.Speed = &speed
+	}
+	// Heading is undefined while standing still
+	if distance > 0 {
+		heading := geo.Bearing(previous.Latitude, previous.Longitude, location.Latitude, location.Longitude)
+		location.Heading = &heading
+	}
+}
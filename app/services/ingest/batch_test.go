@@ -0,0 +1,314 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// history looks points up in stored like storedPoints does in vehicle_locations
+func history(stored ...models.VehicleLocation) pointLookup {
+	return func(vehicleID uint, at time.Time) (*models.VehicleLocation, error) {
+		var found *models.VehicleLocation
+		for i := range stored {
+			s := stored[i]
+			if s.VehicleID != vehicleID || (!at.IsZero() && s.Timestamp.After(at)) {
+				continue
+			}
+			if found == nil || s.Timestamp.After(found.Timestamp) {
+				found = &s
+			}
+		}
+		return found, nil
+	}
+}
+
+func TestScreen(t *testing.T) {
+	lateness := int(MaxLateness / time.Second)
+
+	tests := []struct {
+		name        string
+		stored      []models.VehicleLocation
+		batch       []models.VehicleLocation
+		accepted    []int // detik setelah traceStart dari titik yang diterima
+		late        []bool
+		quarantined []string
+		distance    []float64 // jarak hasil turunan per titik yang diterima, -1 jika kosong
+	}{
+		{
+			name:     "in order",
+			stored:   []models.VehicleLocation{fix(-6.2, 106.8, 0)},
+			batch:    []models.VehicleLocation{fix(-6.2, 106.8, 10), fix(-6.2, 106.8, 20)},
+			accepted: []int{10, 20},
+			late:     []bool{false, false},
+			distance: []float64{0, 0},
+		},
+		{
+			name:     "first point of a vehicle",
+			batch:    []models.VehicleLocation{fix(-6.2, 106.8, 0)},
+			accepted: []int{0},
+			late:     []bool{false},
+			distance: []float64{-1},
+		},
+		{
+			name:        "duplicate of the latest stored point",
+			stored:      []models.VehicleLocation{fix(-6.2, 106.8, 0)},
+			batch:       []models.VehicleLocation{fix(-6.2001, 106.8, 0)},
+			quarantined: []string{ReasonDuplicateTimestamp},
+		},
+		{
+			name:        "duplicate within the batch",
+			batch:       []models.VehicleLocation{fix(-6.2, 106.8, 10), fix(-6.2001, 106.8, 10)},
+			accepted:    []int{10},
+			late:        []bool{false},
+			quarantined: []string{ReasonDuplicateTimestamp},
+			distance:    []float64{-1},
+		},
+		{
+			name:        "duplicate late point within the batch",
+			stored:      []models.VehicleLocation{fix(-6.2, 106.8, 0), fix(-6.2, 106.8, 100)},
+			batch:       []models.VehicleLocation{fix(-6.2, 106.8, 50), fix(-6.2, 106.8, 50)},
+			accepted:    []int{50},
+			late:        []bool{true},
+			quarantined: []string{ReasonDuplicateTimestamp},
+			distance:    []float64{0},
+		},
+		{
+			name:     "late points are compared to the point before them",
+			stored:   []models.VehicleLocation{fix(-6.2, 106.8, 0), fix(-6.2, 106.8, 100)},
+			batch:    []models.VehicleLocation{fix(-6.201, 106.8, 40), fix(-6.201, 106.8, 60)},
+			accepted: []int{40, 60},
+			late:     []bool{true, true},
+			distance: []float64{111, 0},
+		},
+		{
+			name:        "late beyond MaxLateness",
+			stored:      []models.VehicleLocation{fix(-6.2, 106.8, lateness+60)},
+			batch:       []models.VehicleLocation{fix(-6.2, 106.8, 0)},
+			quarantined: []string{ReasonOutOfOrder},
+		},
+		{
+			name:        "impossible jump is skipped",
+			stored:      []models.VehicleLocation{fix(-6.2, 106.8, 0)},
+			batch:       []models.VehicleLocation{fix(-6.3, 106.8, 10), fix(-6.2001, 106.8, 20)},
+			accepted:    []int{20},
+			late:        []bool{false},
+			quarantined: []string{ReasonImpossibleSpeed},
+			distance:    []float64{11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{filters: DefaultFilters()}
+			batch := make([]*pending, len(tt.batch))
+			for i, location := range tt.batch {
+				batch[i] = &pending{vehicle: models.Vehicle{ID: 1, Name: "B1234XYZ"}, location: location}
+			}
+
+			accepted, quarantined, err := p.screen(batch, history(tt.stored...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(accepted) != len(tt.accepted) {
+				t.Fatalf("accepted %d points, want %d", len(accepted), len(tt.accepted))
+			}
+			for i, item := range accepted {
+				if offset := int(item.location.Timestamp.Unix() - traceStart); offset != tt.accepted[i] {
+					t.Errorf("accepted point %d at offset %d, want %d", i, offset, tt.accepted[i])
+				}
+				if item.late != tt.late[i] {
+					t.Errorf("accepted point %d late = %v, want %v", i, item.late, tt.late[i])
+				}
+				distance := item.location.Distance
+				switch {
+				case tt.distance[i] < 0 && distance != nil:
+					t.Errorf("accepted point %d has distance %.1f, want none", i, *distance)
+				case tt.distance[i] >= 0 && (distance == nil || math.Abs(*distance-tt.distance[i]) > 1):
+					t.Errorf("accepted point %d has distance %v, want %.0f m", i, distance, tt.distance[i])
+				}
+			}
+
+			if len(quarantined) != len(tt.quarantined) {
+				t.Fatalf("quarantined %d points, want %d", len(quarantined), len(tt.quarantined))
+			}
+			for i, q := range quarantined {
+				if q.Reason != tt.quarantined[i] {
+					t.Errorf("quarantine reason %q, want %q", q.Reason, tt.quarantined[i])
+				}
+			}
+		})
+	}
+}
+
+const (
+	benchVehiclePrefix = "BENCH-"
+
+	// benchSenders is the number of concurrent senders, like the prefetch/in-flight limit of the consumers
+	benchSenders = 500
+)
+
+// benchVehicle is a vehicle of the benchmark with its own position and clock
+type benchVehicle struct {
+	id        uint
+	name      string
+	lat, lon  float64
+	timestamp int64
+}
+
+func TestIsDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, true},
+		{"numeric out of range", &pgconn.PgError{Code: "22003"}, true},
+		{"wrapped", fmt.Errorf("saving locations: %w", &pgconn.PgError{Code: "23514"}), true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, false},
+		{"timeout", context.DeadlineExceeded, false},
+		{"connection", io.ErrUnexpectedEOF, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDataError(tt.err); got != tt.want {
+				t.Errorf("isDataError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkPipeline measures location ingestion throughput against a real
+// database, comparing row-by-row writes (batch 1) with batched writes. Every
+// sender owns one vehicle and sends its points in order, like a real device, so
+// no point is quarantined. It only runs when DB_HOST is set; the benchmark
+// vehicles and their data are deleted afterwards.
+//
+//	DB_HOST=localhost go test ./app/services/ingest -run '^$' -bench Pipeline -benchtime 20000x
+func BenchmarkPipeline(b *testing.B) {
+	if _, ok := os.LookupEnv("DB_HOST"); !ok {
+		b.Skip("DB_HOST is not set")
+	}
+	config.ConnectDB()
+
+	// Log per batch tidak relevan untuk hasil benchmark
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// Event outbox benchmark dikenali dari ID-nya yang lebih besar dari ID terakhir sebelum benchmark
+	var outboxMark uint
+	if err := config.DB.Model(&models.OutboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&outboxMark).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	parallelism := max(benchSenders/runtime.GOMAXPROCS(0), 1)
+	vehicles := createBenchVehicles(b, parallelism*runtime.GOMAXPROCS(0))
+	defer cleanupBenchVehicles(vehicles, outboxMark)
+
+	for _, size := range []int{1, 500} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			runPipeline(b, size, vehicles)
+		})
+	}
+}
+
+// runPipeline pushes b.N points through a pipeline with the given batch size
+func runPipeline(b *testing.B, batchSize int, vehicles []*benchVehicle) {
+	previous := BatchSize
+	BatchSize = batchSize
+	defer func() { BatchSize = previous }()
+
+	pipeline := NewPipeline()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pipeline.Run(ctx)
+		close(done)
+	}()
+
+	var next, failed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&next, 1) - 1
+		v := vehicles[i]
+		rng := rand.New(rand.NewSource(i))
+		for pb.Next() {
+			// Sekitar 10 meter per detik
+			v.lat += (rng.Float64() - 0.5) * 0.0002
+			v.lon += (rng.Float64() - 0.5) * 0.0002
+			v.timestamp++
+			msg := Message{VehicleID: v.name, Latitude: v.lat, Longitude: v.lon, Timestamp: v.timestamp}
+			if err := pipeline.Ingest(ctx, msg); err != nil {
+				atomic.AddInt64(&failed, 1)
+			}
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "points/s")
+
+	cancel()
+	<-done
+
+	if failed > 0 {
+		b.Errorf("%d of %d points failed", failed, b.N)
+	}
+}
+
+func createBenchVehicles(b *testing.B, n int) []*benchVehicle {
+	rng := rand.New(rand.NewSource(1))
+	// Titik dimulai satu jam yang lalu agar tidak ditolak sebagai timestamp masa depan
+	start := time.Now().Add(-time.Hour).Unix()
+
+	vehicles := make([]*benchVehicle, n)
+	for i := range vehicles {
+		vehicle := models.Vehicle{Name: fmt.Sprintf("%s%03d", benchVehiclePrefix, i)}
+		if err := config.DB.Create(&vehicle).Error; err != nil {
+			b.Fatalf("failed to create benchmark vehicle: %v", err)
+		}
+		vehicles[i] = &benchVehicle{
+			id:        vehicle.ID,
+			name:      vehicle.Name,
+			lat:       -6.40 + rng.Float64()*0.35,
+			lon:       106.65 + rng.Float64()*0.40,
+			timestamp: start,
+		}
+	}
+	return vehicles
+}
+
+// cleanupBenchVehicles deletes the benchmark vehicles and the outbox events
+// enqueued for them; all other rows of a vehicle are deleted by ON DELETE CASCADE
+func cleanupBenchVehicles(vehicles []*benchVehicle, outboxMark uint) {
+	ids := make([]uint, len(vehicles))
+	keys := make([]string, len(vehicles))
+	for i, v := range vehicles {
+		ids[i] = v.id
+		keys[i] = strconv.FormatUint(uint64(v.id), 10)
+	}
+
+	// Outbox tidak memiliki foreign key ke kendaraan, vehicle_id di payload adalah ID kendaraan
+	if err := config.DB.Where("id > ? AND payload->>'vehicle_id' IN ?", outboxMark, keys).Delete(&models.OutboxEvent{}).Error; err != nil {
+		log.Printf("Failed to delete benchmark outbox events: %v", err)
+	}
+	if err := config.DB.Unscoped().Where("id IN ?", ids).Delete(&models.Vehicle{}).Error; err != nil {
+		log.Printf("Failed to delete benchmark vehicles: %v", err)
+	}
+}
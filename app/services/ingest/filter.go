@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"math"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
+)
+
+// Reasons recorded for quarantined locations
+const (
+	ReasonOutOfRange         = "out_of_range"
+	ReasonNullIsland         = "null_island"
+	ReasonFutureTimestamp    = "future_timestamp"
+	ReasonDuplicateTimestamp = "duplicate_timestamp"
+	ReasonOutOfOrder         = "out_of_order"
+	ReasonImpossibleSpeed    = "impossible_speed"
+)
+
+// nullIslandTolerance is how close to (0,0) a fix has to be to be treated as a missing fix
+const nullIslandTolerance = 0.0001
+
+var (
+	// MaxSpeed is the highest plausible speed (km/h) between two consecutive fixes
+	MaxSpeed = config.GetFloat("INGEST_MAX_SPEED", 200)
+
+	// MaxLateness is how far behind the latest point of a vehicle a late point may
+	// be and still be stored; older points are quarantined as out of order. 0 rejects every late point.
+	MaxLateness = config.GetDuration("INGEST_MAX_LATENESS", 24*time.Hour)
+
+	// MaxClockSkew is how far ahead of the server clock a timestamp may be, for
+	// devices whose clock runs slightly fast
+	MaxClockSkew = config.GetDuration("INGEST_MAX_CLOCK_SKEW", 5*time.Minute)
+)
+
+// Filter returns the reason a location must be rejected, or "" to keep it.
+// previous is the accepted point of the vehicle right before the location in
+// time, nil if there is none. For a late point it is not the latest point of the vehicle.
+type Filter func(location models.VehicleLocation, previous *models.VehicleLocation) string
+
+// DefaultFilters returns the filters applied by NewPipeline when none are given
+func DefaultFilters() []Filter {
+	return []Filter{
+		RejectOutOfRange,
+		RejectNullIsland,
+		RejectFutureTimestamp,
+		RejectStaleTimestamp,
+		RejectImpossibleSpeed,
+	}
+}
+
+// RejectOutOfRange rejects coordinates outside latitude -90..90 and longitude -180..180
+func RejectOutOfRange(location models.VehicleLocation, _ *models.VehicleLocation) string {
+	if math.IsNaN(location.Latitude) || math.IsNaN(location.Longitude) ||
+		location.Latitude < -90 || location.Latitude > 90 ||
+		location.Longitude < -180 || location.Longitude > 180 {
+		return ReasonOutOfRange
+	}
+	return ""
+}
+
+// RejectNullIsland rejects (0,0) fixes sent by trackers without a GPS lock
+func RejectNullIsland(location models.VehicleLocation, _ *models.VehicleLocation) string {
+	if math.Abs(location.Latitude) < nullIslandTolerance && math.Abs(location.Longitude) < nullIslandTolerance {
+		return ReasonNullIsland
+	}
+	return ""
+}
+
+// RejectFutureTimestamp rejects points dated more than MaxClockSkew after now.
+// Accepted, such a point would become the latest point of the vehicle and
+// turn every real point after it into a late or out of order one.
+func RejectFutureTimestamp(location models.VehicleLocation, _ *models.VehicleLocation) string {
+	if location.Timestamp.After(time.Now().Add(MaxClockSkew)) {
+		return ReasonFutureTimestamp
+	}
+	return ""
+}
+
+// RejectStaleTimestamp rejects points that are not newer than the previous point,
+// i.e. a second point with the same timestamp
+func RejectStaleTimestamp(location models.VehicleLocation, previous *models.VehicleLocation) string {
+	if previous == nil {
+		return ""
+	}
+	if location.Timestamp.Equal(previous.Timestamp) {
+		return ReasonDuplicateTimestamp
+	}
+	if location.Timestamp.Before(previous.Timestamp) {
+		return ReasonOutOfOrder
+	}
+	return ""
+}
+
+// RejectImpossibleSpeed rejects jumps that imply a speed above MaxSpeed since the previous point
+func RejectImpossibleSpeed(location models.VehicleLocation, previous *models.VehicleLocation) string {
+	if previous == nil || MaxSpeed <= 0 {
+		return ""
+	}
+
+	elapsed := location.Timestamp.Sub(previous.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return ""
+	}
+
+	distance := geo.Distance(previous.Latitude, previous.Longitude, location.Latitude, location.Longitude)
+	if distance/elapsed*3.6 > MaxSpeed {
+		return ReasonImpossibleSpeed
+	}
+	return ""
+}
+
+// check runs the filters of the pipeline in order and returns the first rejection reason
+func (p *Pipeline) check(location models.VehicleLocation, previous *models.VehicleLocation) string {
+	for _, filter := range p.filters {
+		if reason := filter(location, previous); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+)
+
+// traceStart is the Unix time of the first fix of the test traces
+const traceStart = 1717200000
+
+// fix returns a GPS fix of vehicle 1 taken second seconds after traceStart
+func fix(lat, lon float64, second int) models.VehicleLocation {
+	return models.VehicleLocation{VehicleID: 1, Latitude: lat, Longitude: lon, Timestamp: time.Unix(traceStart+int64(second), 0).UTC()}
+}
+
+func TestFilters(t *testing.T) {
+	previous := fix(-6.2, 106.8, 0)
+	now := models.VehicleLocation{Latitude: -6.2, Longitude: 106.8, Timestamp: time.Now()}
+	future := now
+	future.Timestamp = now.Timestamp.Add(MaxClockSkew + time.Minute)
+	skewed := now
+	skewed.Timestamp = now.Timestamp.Add(MaxClockSkew / 2)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		location models.VehicleLocation
+		previous *models.VehicleLocation
+		want     string
+	}{
+		{"valid coordinates", RejectOutOfRange, fix(-6.2, 106.8, 0), nil, ""},
+		{"latitude above 90", RejectOutOfRange, fix(91, 106.8, 0), nil, ReasonOutOfRange},
+		{"longitude below -180", RejectOutOfRange, fix(-6.2, -181, 0), nil, ReasonOutOfRange},
+		{"NaN latitude", RejectOutOfRange, fix(math.NaN(), 106.8, 0), nil, ReasonOutOfRange},
+
+		{"null island", RejectNullIsland, fix(0, 0, 0), nil, ReasonNullIsland},
+		{"near null island", RejectNullIsland, fix(0.00005, -0.00005, 0), nil, ReasonNullIsland},
+		{"equator but not null island", RejectNullIsland, fix(0, 106.8, 0), nil, ""},
+
+		{"timestamp in the past", RejectFutureTimestamp, previous, nil, ""},
+		{"timestamp within clock skew", RejectFutureTimestamp, skewed, nil, ""},
+		{"timestamp in the future", RejectFutureTimestamp, future, nil, ReasonFutureTimestamp},
+
+		{"first point", RejectStaleTimestamp, fix(-6.2, 106.8, 0), nil, ""},
+		{"newer point", RejectStaleTimestamp, fix(-6.2, 106.8, 1), &previous, ""},
+		{"same timestamp", RejectStaleTimestamp, fix(-6.2, 106.8, 0), &previous, ReasonDuplicateTimestamp},
+		{"older point", RejectStaleTimestamp, fix(-6.2, 106.8, -1), &previous, ReasonOutOfOrder},
+
+		// 0,001 derajat lintang ~111 m
+		{"plausible speed", RejectImpossibleSpeed, fix(-6.201, 106.8, 10), &previous, ""},
+		{"impossible jump", RejectImpossibleSpeed, fix(-6.21, 106.8, 10), &previous, ReasonImpossibleSpeed},
+		{"no previous point", RejectImpossibleSpeed, fix(-6.21, 106.8, 10), nil, ""},
+		{"no elapsed time", RejectImpossibleSpeed, fix(-6.21, 106.8, 0), &previous, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter(tt.location, tt.previous); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReturnsFirstRejection(t *testing.T) {
+	p := &Pipeline{filters: DefaultFilters()}
+	previous := fix(-6.2, 106.8, 0)
+
+	// Titik (0,0) sekaligus lompatan mustahil: filter null island berjalan lebih dulu
+	if got := p.check(fix(0, 0, 10), &previous); got != ReasonNullIsland {
+		t.Errorf("check() = %q, want %q", got, ReasonNullIsland)
+	}
+	if got := p.check(fix(-6.2001, 106.8, 10), &previous); got != "" {
+		t.Errorf("check() = %q for a valid point", got)
+	}
+}
@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidMessage is returned for payloads that can never be processed
+	ErrInvalidMessage = errors.New("invalid location message")
+
+	// ErrUnknownVehicle is returned when the vehicle_id does not match any vehicle
+	ErrUnknownVehicle = errors.New("unknown vehicle")
+)
+
+// IsPermanent reports whether the error can never be resolved by retrying the message
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrInvalidMessage) || errors.Is(err, ErrUnknownVehicle)
+}
+
+// Message is a location update as sent by a vehicle, regardless of transport
+type Message struct {
+	VehicleID string  `json:"vehicle_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timestamp int64   `json:"timestamp"`
+
+	// Optional values reported by the device
+	Speed    *float64 `json:"speed,omitempty"`    // dalam km/jam
+	Heading  *float64 `json:"heading,omitempty"`  // dalam derajat, 0 = utara
+	Altitude *float64 `json:"altitude,omitempty"` // dalam meter
+	Accuracy *float64 `json:"accuracy,omitempty"` // dalam meter
+}
+
+// Validate checks the required fields. Implausible coordinates are not an
+// error, they are quarantined by the pipeline filters.
+func (m Message) Validate() error {
+	if m.VehicleID == "" {
+		return fmt.Errorf("%w: missing vehicle_id", ErrInvalidMessage)
+	}
+	if m.Timestamp == 0 {
+		return fmt.Errorf("%w: missing timestamp", ErrInvalidMessage)
+	}
+	if m.Speed != nil && *m.Speed < 0 {
+		return fmt.Errorf("%w: negative speed %f", ErrInvalidMessage, *m.Speed)
+	}
+	if m.Heading != nil && (*m.Heading < 0 || *m.Heading > 360) {
+		return fmt.Errorf("%w: heading %f out of range", ErrInvalidMessage, *m.Heading)
+	}
+	if m.Accuracy != nil && *m.Accuracy < 0 {
+		return fmt.Errorf("%w: negative accuracy %f", ErrInvalidMessage, *m.Accuracy)
+	}
+	return nil
+}
+
+// Pipeline validates, resolves, stores and evaluates location updates. Every
+// transport (MQTT, AMQP) feeds its raw payloads into the same pipeline.
+// Locations are written in batches by Run; geofence events are written to
+// the outbox and published by outbox.Relay.
+type Pipeline struct {
+	batchSize     int
+	flushInterval time.Duration
+	filters       []Filter
+
+	queue   chan *pending
+	stopped chan struct{}
+}
+
+// NewPipeline creates a location ingestion pipeline. Locations rejected by one
+// of the filters (DefaultFilters when none are given) are quarantined instead
+// of stored. Run must be started before locations are ingested.
+func NewPipeline(filters ...Filter) *Pipeline {
+	if len(filters) == 0 {
+		filters = DefaultFilters()
+	}
+
+	size := BatchSize
+	if size <= 0 {
+		size = 1
+	}
+	interval := FlushInterval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	return &Pipeline{
+		batchSize:     size,
+		flushInterval: interval,
+		filters:       filters,
+		queue:         make(chan *pending, size),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// HandleJSON decodes a JSON payload and ingests it
+func (p *Pipeline) HandleJSON(ctx context.Context, payload []byte) error {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return p.Ingest(ctx, msg)
+}
+
+// Ingest processes a single location update
+func (p *Pipeline) Ingest(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	vehicle, err := ResolveVehicle(msg.VehicleID)
+	if err != nil {
+		return err
+	}
+
+	location := models.VehicleLocation{
+		VehicleID: vehicle.ID,
+		Latitude:  msg.Latitude,
+		Longitude: msg.Longitude,
+		Timestamp: time.Unix(msg.Timestamp, 0),
+
+		ReportedSpeed:   msg.Speed,
+		ReportedHeading: msg.Heading,
+		Altitude:        msg.Altitude,
+		Accuracy:        msg.Accuracy,
+	}
+
+	// The location, the geofence state and the outbox events are committed
+	// together, so an event is never lost or emitted for an unsaved location
+	return p.submit(ctx, vehicle, location)
+}
+
+// ResolveVehicle finds the vehicle for a vehicle_id sent by a device. The
+// vehicle code (name) is tried first, then the numeric database ID.
+func ResolveVehicle(vehicleID string) (models.Vehicle, error) {
+	var vehicle models.Vehicle
+
+	err := config.DB.Where("name = ?", vehicleID).First(&vehicle).Error
+	if err == nil {
+		return vehicle, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return vehicle, fmt.Errorf("resolving vehicle %s: %w", vehicleID, err)
+	}
+
+	id, parseErr := strconv.ParseUint(vehicleID, 10, 32)
+	if parseErr != nil {
+		return vehicle, fmt.Errorf("%w: %s", ErrUnknownVehicle, vehicleID)
+	}
+
+	err = config.DB.First(&vehicle, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return vehicle, fmt.Errorf("%w: %s", ErrUnknownVehicle, vehicleID)
+	}
+	if err != nil {
+		return vehicle, fmt.Errorf("resolving vehicle %s: %w", vehicleID, err)
+	}
+	return vehicle, nil
+}
@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+)
+
+const maxBackoff = 5 * time.Minute
+
+var (
+	// PollInterval is how often the relay looks for pending events
+	PollInterval = config.GetDuration("OUTBOX_POLL_INTERVAL", time.Second)
+
+	// BatchSize is how many events are claimed at once
+	BatchSize = config.GetInt("OUTBOX_BATCH_SIZE", 100)
+
+	// ClaimTimeout is how long claimed events are reserved for the relay that
+	// publishes them; events that are not delivered by then are claimed again
+	ClaimTimeout = config.GetDuration("OUTBOX_CLAIM_TIMEOUT", time.Minute)
+
+	// Retention is how long delivered events are kept before being deleted
+	Retention = config.GetDuration("OUTBOX_RETENTION", 24*time.Hour)
+)
+
+// Publisher sends a message body to an exchange and waits for the broker to accept it
+type Publisher interface {
+	Publish(ctx context.Context, exchange, routingKey, messageID string, body []byte) error
+}
+
+// MessageID is the message ID an outbox event is published with. It stays the
+// same when the event is published again, so consumers can deduplicate on it.
+func MessageID(event models.OutboxEvent) string {
+	return "outbox-" + strconv.FormatUint(uint64(event.ID), 10)
+}
+
+// Enqueue stores an event in the outbox using the caller's transaction
+func Enqueue(tx *gorm.DB, exchange, routingKey, eventType string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.OutboxEvent{
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		EventType:     eventType,
+		Payload:       body,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Relay publishes pending outbox events, giving at-least-once delivery.
+// Several relays may run at once; each claims the events it publishes.
+type Relay struct {
+	publisher Publisher
+	batchSize int
+}
+
+// NewRelay creates a relay that publishes through the publisher
+func NewRelay(publisher Publisher) *Relay {
+	return &Relay{
+		publisher: publisher,
+		batchSize: BatchSize,
+	}
+}
+
+// Run polls the outbox until ctx is canceled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	log.Printf("Outbox relay started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Outbox relay stopped")
+			return
+		case <-cleanup.C:
+			r.purgeDelivered()
+		case <-ticker.C:
+			// Keep draining while full batches come back
+			for {
+				n, err := r.relayBatch(ctx)
+				if err != nil {
+					log.Printf("Outbox relay error: %v", err)
+					break
+				}
+				if n < r.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relayBatch publishes one batch of due events and returns how many were
+// claimed. The events are claimed in a short transaction and published outside
+// of it, stopping at the first failure so later events of the same vehicle
+// don't overtake the failed one.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	events, err := r.claim()
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	// Stop before the claim expires, so no other relay publishes the same events meanwhile
+	ctx, cancel := context.WithTimeout(ctx, ClaimTimeout)
+	defer cancel()
+
+	for i, event := range events {
+		if err := r.publisher.Publish(ctx, event.Exchange, event.RoutingKey, MessageID(event), event.Payload); err != nil {
+			attempts := event.Attempts + 1
+			if err := retryLater(event, attempts, err, events[i+1:]); err != nil {
+				return len(events), err
+			}
+			return len(events), fmt.Errorf("publishing outbox event %d (attempt %d): %w", event.ID, attempts, err)
+		}
+
+		if err := config.DB.Model(&event).Updates(map[string]interface{}{
+			"attempts":     event.Attempts + 1,
+			"last_error":   "",
+			"delivered_at": time.Now(),
+		}).Error; err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// claim reserves the next due events for ClaimTimeout, in ID order. An event is
+// held back while an earlier event of the same vehicle is pending but not due,
+// because it backs off after a failure or another relay claimed it, so the
+// events of a vehicle are published in the order they were written.
+func (r *Relay) claim() ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claims are serialized between relays so each one sees the claims of the others
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "outbox_claim").Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Raw(`
+			UPDATE outbox SET next_attempt_at = @until
+			WHERE id IN (
+				SELECT id FROM outbox o
+				WHERE delivered_at IS NULL AND next_attempt_at <= @now
+					AND NOT EXISTS (
+						SELECT 1 FROM outbox earlier
+						WHERE earlier.delivered_at IS NULL AND earlier.next_attempt_at > @now
+							AND earlier.payload->>'vehicle_id' = o.payload->>'vehicle_id'
+							AND earlier.id < o.id
+					)
+				ORDER BY id
+				LIMIT @limit
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *`, map[string]interface{}{
+			"until": now.Add(ClaimTimeout),
+			"now":   now,
+			"limit": r.batchSize,
+		}).Scan(&events).Error
+	})
+
+	// RETURNING tidak menjamin urutan
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, err
+}
+
+// retryLater schedules the next attempt of a failed event with backoff and
+// releases the claim on the unpublished rest of the batch
+func retryLater(event models.OutboxEvent, attempts int, cause error, rest []models.OutboxEvent) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&event).Updates(map[string]interface{}{
+			"attempts":        attempts,
+			"last_error":      cause.Error(),
+			"next_attempt_at": time.Now().Add(backoff(attempts)),
+		}).Error; err != nil {
+			return err
+		}
+		if len(rest) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(rest))
+		for i, e := range rest {
+			ids[i] = e.ID
+		}
+		return tx.Model(&models.OutboxEvent{}).
+			Where("id IN ? AND delivered_at IS NULL", ids).
+			Update("next_attempt_at", time.Now()).Error
+	})
+}
+
+// purgeDelivered deletes delivered events older than Retention
+func (r *Relay) purgeDelivered() {
+	result := config.DB.Where("delivered_at < ?", time.Now().Add(-Retention)).Delete(&models.OutboxEvent{})
+	if result.Error != nil {
+		log.Printf("Failed to purge delivered outbox events: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Purged %d delivered outbox events", result.RowsAffected)
+	}
+}
+
+// backoff returns the delay before the next publish attempt
+func backoff(attempts int) time.Duration {
+	delay := time.Second << uint(attempts-1)
+	if attempts > 16 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
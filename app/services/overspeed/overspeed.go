@@ -0,0 +1,189 @@
+package overspeed
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/config"
+	"tj_techtest/pkg/rabbitmq"
+
+	"gorm.io/gorm"
+)
+
+const (
+	Event      = "overspeed"
+	EventEnded = "overspeed_ended"
+)
+
+// MinDuration is how long a vehicle has to stay above the speed limit of a
+// geofence before an overspeed event is emitted
+var MinDuration = config.GetDuration("OVERSPEED_MIN_DURATION", 30*time.Second)
+
+// tracker follows the overspeed violations of one vehicle. Points must be added in time order.
+type tracker struct {
+	index     *geofence.Index
+	vehicleID uint
+	open      map[uint]*models.OverspeedViolation // pelanggaran yang berlangsung per geofence
+	changed   []*models.OverspeedViolation
+	discarded []uint // pelanggaran tersimpan yang berakhir sebelum MinDuration
+	emitted   []emission
+}
+
+func newTracker(index *geofence.Index, vehicleID uint, stored []models.OverspeedViolation) *tracker {
+	t := &tracker{
+		index:     index,
+		vehicleID: vehicleID,
+		open:      make(map[uint]*models.OverspeedViolation, len(stored)),
+	}
+	for i := range stored {
+		t.open[stored[i].GeofenceID] = &stored[i]
+	}
+	return t
+}
+
+func (t *tracker) add(location models.VehicleLocation) {
+	// Tanpa kecepatan tidak diketahui apakah pelanggaran masih berlangsung
+	speed := location.CurrentSpeed()
+	if speed == nil {
+		return
+	}
+
+	speeding := make(map[uint]bool)
+	for _, entry := range t.index.Locate(location.Latitude, location.Longitude, t.vehicleID) {
+		limit := entry.Geofence.SpeedLimit
+		if limit == nil || *speed <= *limit {
+			continue
+		}
+		speeding[entry.Geofence.ID] = true
+
+		v, ok := t.open[entry.Geofence.ID]
+		if !ok {
+			v = &models.OverspeedViolation{
+				VehicleID:  t.vehicleID,
+				GeofenceID: entry.Geofence.ID,
+				SpeedLimit: *limit,
+				StartedAt:  location.Timestamp,
+			}
+			t.open[entry.Geofence.ID] = v
+		}
+		if *speed > v.PeakSpeed {
+			v.PeakSpeed = *speed
+			v.Latitude = location.Latitude
+			v.Longitude = location.Longitude
+		}
+		v.LastAt = location.Timestamp
+		v.DurationSeconds = v.LastAt.Sub(v.StartedAt).Seconds()
+		if !v.Notified && v.LastAt.Sub(v.StartedAt) >= MinDuration {
+			v.Notified = true
+			t.emitted = append(t.emitted, emission{Event, v, *v})
+		}
+		t.changed = appendOnce(t.changed, v)
+	}
+
+	// Violations without a speeding point end here
+	for geofenceID, v := range t.open {
+		if speeding[geofenceID] {
+			continue
+		}
+		delete(t.open, geofenceID)
+		if !v.Notified {
+			t.changed = remove(t.changed, v)
+			if v.ID != 0 {
+				t.discarded = append(t.discarded, v.ID)
+			}
+			continue
+		}
+		endedAt := v.LastAt
+		v.EndedAt = &endedAt
+		t.changed = appendOnce(t.changed, v)
+		t.emitted = append(t.emitted, emission{EventEnded, v, *v})
+	}
+}
+
+// Evaluate checks the new locations of one vehicle, in time order, against the
+// speed limits of the geofences they lie in. A violation starts at the first
+// point above the limit and ends at the first point in the zone at or below
+// it, or outside the zone; points without a speed are skipped. An overspeed
+// event is emitted once the violation lasted MinDuration and an overspeed_ended
+// event with its final peak speed and duration when it ends. Shorter violations
+// are discarded when they end.
+func Evaluate(tx *gorm.DB, vehicle models.Vehicle, locations []models.VehicleLocation) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	index, err := geofence.CurrentIndex()
+	if err != nil {
+		return err
+	}
+
+	var stored []models.OverspeedViolation
+	if err := tx.Where("vehicle_id = ? AND ended_at IS NULL", vehicle.ID).Find(&stored).Error; err != nil {
+		return err
+	}
+
+	t := newTracker(index, vehicle.ID, stored)
+	for _, location := range locations {
+		t.add(location)
+	}
+
+	if len(t.discarded) > 0 {
+		if err := tx.Delete(&models.OverspeedViolation{}, t.discarded).Error; err != nil {
+			return err
+		}
+	}
+	for _, v := range t.changed {
+		if err := tx.Save(v).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, e := range t.emitted {
+		entry, ok := index.Get(e.violation.GeofenceID)
+		if !ok {
+			continue
+		}
+		if e.event == Event {
+			log.Printf("Vehicle %s exceeded %.0f km/h in geofence %s", vehicle.Name, e.state.SpeedLimit, entry.Geofence.Name)
+		} else {
+			log.Printf("Vehicle %s overspeed in geofence %s ended after %.0fs, peak %.1f km/h", vehicle.Name, entry.Geofence.Name, e.state.DurationSeconds, e.state.PeakSpeed)
+		}
+
+		// ID baru tersedia setelah pelanggaran disimpan
+		e.state.ID = e.violation.ID
+		event := fleet.NewOverspeedEvent(vehicle, entry.Geofence, e.event, e.state)
+		if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", e.event, event); err != nil {
+			return fmt.Errorf("enqueueing overspeed event: %w", err)
+		}
+	}
+	return nil
+}
+
+// emission is an event of a violation with the state it had at that point
+type emission struct {
+	event     string
+	violation *models.OverspeedViolation
+	state     models.OverspeedViolation
+}
+
+func appendOnce(violations []*models.OverspeedViolation, v *models.OverspeedViolation) []*models.OverspeedViolation {
+	for _, existing := range violations {
+		if existing == v {
+			return violations
+		}
+	}
+	return append(violations, v)
+}
+
+func remove(violations []*models.OverspeedViolation, v *models.OverspeedViolation) []*models.OverspeedViolation {
+	for i, existing := range violations {
+		if existing == v {
+			return append(violations[:i], violations[i+1:]...)
+		}
+	}
+	return violations
+}
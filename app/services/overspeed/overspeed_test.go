@@ -0,0 +1,206 @@
+package overspeed
+
+import (
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+)
+
+// sample is a point inside or outside the speed limited zone, offset from the
+// start of the drive; speed < 0 means no speed
+type sample struct {
+	offset time.Duration
+	speed  float64
+	inside bool
+}
+
+func testIndex(t *testing.T) *geofence.Index {
+	t.Helper()
+	limit := 60.0
+	index := geofence.NewIndex(geofence.DefaultCellSize)
+	zones := []models.Geofence{
+		{ID: 1, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 500, SpeedLimit: &limit},
+		// Geofence tanpa batas kecepatan di lokasi yang sama tidak pernah menghasilkan pelanggaran
+		{ID: 2, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 500},
+	}
+	for _, zone := range zones {
+		if err := index.Set(zone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func (s sample) location(start time.Time) models.VehicleLocation {
+	l := models.VehicleLocation{VehicleID: 7, Latitude: -6.2, Longitude: 106.8, Timestamp: start.Add(s.offset)}
+	if !s.inside {
+		l.Latitude = -6.3
+	}
+	if s.speed >= 0 {
+		speed := s.speed
+		l.Speed = &speed
+	}
+	return l
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2024, 3, 4, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		samples      []sample
+		want         []string
+		wantPeak     float64 // puncak kecepatan pada event terakhir
+		wantOpen     bool    // pelanggaran masih berlangsung setelah semua titik
+		wantSaved    int
+		wantDuration time.Duration // durasi pada event terakhir
+	}{
+		{
+			name:    "below the limit",
+			samples: []sample{{0, 50, true}, {time.Minute, 60, true}},
+		},
+		{
+			name:    "short violation is discarded",
+			samples: []sample{{0, 80, true}, {10 * time.Second, 80, true}, {20 * time.Second, 50, true}},
+		},
+		{
+			name:         "sustained violation",
+			samples:      []sample{{0, 80, true}, {MinDuration, 90, true}, {MinDuration + 10*time.Second, 70, true}, {MinDuration + 20*time.Second, 50, true}},
+			want:         []string{Event, EventEnded},
+			wantPeak:     90,
+			wantSaved:    1,
+			wantDuration: MinDuration + 10*time.Second,
+		},
+		{
+			name:         "still speeding",
+			samples:      []sample{{0, 80, true}, {MinDuration, 85, true}},
+			want:         []string{Event},
+			wantPeak:     85,
+			wantOpen:     true,
+			wantSaved:    1,
+			wantDuration: MinDuration,
+		},
+		{
+			name:         "leaving the zone ends the violation",
+			samples:      []sample{{0, 80, true}, {MinDuration, 80, true}, {MinDuration + 10*time.Second, 80, false}},
+			want:         []string{Event, EventEnded},
+			wantPeak:     80,
+			wantSaved:    1,
+			wantDuration: MinDuration,
+		},
+		{
+			name:         "points without speed are skipped",
+			samples:      []sample{{0, 80, true}, {10 * time.Second, -1, true}, {MinDuration, 80, true}},
+			want:         []string{Event},
+			wantPeak:     80,
+			wantOpen:     true,
+			wantSaved:    1,
+			wantDuration: MinDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTracker(testIndex(t), 7, nil)
+			for _, s := range tt.samples {
+				tr.add(s.location(start))
+			}
+
+			var events []string
+			for _, e := range tr.emitted {
+				if e.state.GeofenceID != 1 {
+					t.Errorf("event for geofence %d, want 1", e.state.GeofenceID)
+				}
+				events = append(events, e.event)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %v, want %v", events, tt.want)
+			}
+			for i := range events {
+				if events[i] != tt.want[i] {
+					t.Fatalf("events = %v, want %v", events, tt.want)
+				}
+			}
+
+			if len(tr.emitted) > 0 {
+				last := tr.emitted[len(tr.emitted)-1].state
+				if last.PeakSpeed != tt.wantPeak {
+					t.Errorf("peak speed = %v, want %v", last.PeakSpeed, tt.wantPeak)
+				}
+				if got := time.Duration(last.DurationSeconds * float64(time.Second)); got != tt.wantDuration {
+					t.Errorf("duration = %v, want %v", got, tt.wantDuration)
+				}
+				if (last.EndedAt == nil) != tt.wantOpen {
+					t.Errorf("ended at = %v, want open %v", last.EndedAt, tt.wantOpen)
+				}
+			}
+			if len(tr.changed) != tt.wantSaved {
+				t.Errorf("%d violations to save, want %d", len(tr.changed), tt.wantSaved)
+			}
+			if _, open := tr.open[1]; open != tt.wantOpen {
+				t.Errorf("violation open = %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestTrackerResumesStoredViolations(t *testing.T) {
+	start := time.Date(2024, 3, 4, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		stored        models.OverspeedViolation
+		want          []string
+		wantDiscarded []uint
+	}{
+		{
+			name:   "notified violation ends",
+			stored: models.OverspeedViolation{ID: 5, VehicleID: 7, GeofenceID: 1, SpeedLimit: 60, PeakSpeed: 90, StartedAt: start, LastAt: start.Add(MinDuration), Notified: true},
+			want:   []string{EventEnded},
+		},
+		{
+			name:          "short stored violation is discarded",
+			stored:        models.OverspeedViolation{ID: 6, VehicleID: 7, GeofenceID: 1, SpeedLimit: 60, PeakSpeed: 70, StartedAt: start, LastAt: start.Add(time.Second)},
+			wantDiscarded: []uint{6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTracker(testIndex(t), 7, []models.OverspeedViolation{tt.stored})
+			tr.add(sample{MinDuration + time.Minute, 40, true}.location(start))
+
+			if len(tr.emitted) != len(tt.want) {
+				t.Fatalf("%d events, want %v", len(tr.emitted), tt.want)
+			}
+			for i, e := range tr.emitted {
+				if e.event != tt.want[i] || e.violation.ID != tt.stored.ID {
+					t.Errorf("event %q for violation %d, want %q for %d", e.event, e.violation.ID, tt.want[i], tt.stored.ID)
+				}
+				// Pelanggaran berakhir pada titik terakhir yang masih melanggar
+				if e.state.EndedAt == nil || !e.state.EndedAt.Equal(tt.stored.LastAt) {
+					t.Errorf("ended at = %v, want %v", e.state.EndedAt, tt.stored.LastAt)
+				}
+			}
+			if len(tr.discarded) != len(tt.wantDiscarded) || (len(tt.wantDiscarded) > 0 && tr.discarded[0] != tt.wantDiscarded[0]) {
+				t.Errorf("discarded = %v, want %v", tr.discarded, tt.wantDiscarded)
+			}
+		})
+	}
+}
+
+func TestTrackerUsesReportedSpeed(t *testing.T) {
+	start := time.Date(2024, 3, 4, 22, 0, 0, 0, time.UTC)
+	tr := newTracker(testIndex(t), 7, nil)
+	for _, offset := range []time.Duration{0, MinDuration} {
+		l := sample{offset, 40, true}.location(start)
+		reported := 75.0
+		l.ReportedSpeed = &reported
+		tr.add(l)
+	}
+
+	if len(tr.emitted) != 1 || tr.emitted[0].state.PeakSpeed != 75 {
+		t.Errorf("emitted = %+v, want one overspeed at the reported 75 km/h", tr.emitted)
+	}
+}
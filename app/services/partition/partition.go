@@ -0,0 +1,267 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Table is the partitioned location history table
+	Table = "vehicle_locations"
+
+	// prefix and dateFormat name daily partitions, e.g. vehicle_locations_p20240131
+	prefix     = Table + "_p"
+	dateFormat = "20060102"
+
+	// defaultPartition holds locations of days without a daily partition
+	defaultPartition = Table + "_default"
+)
+
+var (
+	// Interval is how often partitions are maintained
+	Interval = config.GetDuration("PARTITION_MAINTENANCE_INTERVAL", time.Hour)
+
+	// DaysAhead is how many future daily partitions are kept ready
+	DaysAhead = config.GetInt("PARTITION_DAYS_AHEAD", 7)
+
+	// RetentionDays is how many days of location history are kept; 0 keeps everything
+	RetentionDays = config.GetInt("LOCATION_RETENTION_DAYS", 90)
+
+	// Archive detaches expired partitions instead of dropping them, so they can
+	// be exported (e.g. with pg_dump) and dropped afterwards
+	Archive = config.GetEnv("LOCATION_RETENTION_MODE", "drop") == "archive"
+)
+
+// Run maintains the partitions now and then every Interval until ctx is canceled
+func Run(ctx context.Context) {
+	interval := Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Maintain(time.Now()); err != nil {
+			log.Printf("Partition maintenance failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain creates the partitions for today and DaysAhead days after it, and
+// drops or detaches partitions that are entirely older than RetentionDays,
+// including the expired days still held by the default partition. Every
+// partition is handled in its own transaction, so one that fails doesn't hold
+// back the others.
+func Maintain(now time.Time) error {
+	var errs []error
+
+	today := day(now)
+	for i := 0; i <= DaysAhead; i++ {
+		t := today.AddDate(0, 0, i)
+		errs = append(errs, step(func(tx *gorm.DB) error {
+			return create(tx, t)
+		}))
+	}
+
+	if RetentionDays <= 0 {
+		return errors.Join(errs...)
+	}
+
+	cutoff := today.AddDate(0, 0, -RetentionDays)
+	errs = append(errs, step(func(tx *gorm.DB) error {
+		return expireDefault(tx, cutoff)
+	}))
+
+	partitions, err := list(config.DB)
+	if err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+
+	for _, name := range partitions {
+		start, err := time.Parse(dateFormat, strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue // default partition or a table not created by us
+		}
+		if !start.AddDate(0, 0, 1).After(cutoff) {
+			name := name
+			errs = append(errs, step(func(tx *gorm.DB) error {
+				return expire(tx, name)
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// step runs one maintenance change in a transaction, serialized between API instances
+func step(change func(tx *gorm.DB) error) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", Table+"_partitions").Error; err != nil {
+			return err
+		}
+		return change(tx)
+	})
+}
+
+// bounds returns the partition that stores locations recorded at t
+func bounds(t time.Time) (name string, from, to time.Time) {
+	from = day(t)
+	return prefix + from.Format(dateFormat), from, from.AddDate(0, 0, 1)
+}
+
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// create creates the partition of the day of t. Rows of that day already in
+// the default partition would make the creation fail, so they are moved into
+// the new partition.
+func create(tx *gorm.DB, t time.Time) error {
+	name, from, to := bounds(t)
+
+	if found, err := exists(tx, name); err != nil || found {
+		return err
+	}
+
+	var stray bool
+	if err := tx.Raw(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE timestamp >= ? AND timestamp < ?)", defaultPartition), from, to).Scan(&stray).Error; err != nil {
+		return err
+	}
+
+	moved := name + "_moved"
+	if stray {
+		// Insert baru ditahan selama pemindahan agar tidak ada baris hari tersebut
+		// yang masuk ke partisi default setelah dipindahkan
+		if err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", Table)).Error; err != nil {
+			return err
+		}
+		err := tx.Exec(fmt.Sprintf(
+			"CREATE TEMP TABLE %s ON COMMIT DROP AS WITH moved AS (DELETE FROM %s WHERE timestamp >= ? AND timestamp < ? RETURNING *) SELECT * FROM moved",
+			moved, defaultPartition,
+		), from, to).Error
+		if err != nil {
+			return fmt.Errorf("moving default partition rows of %s: %w", name, err)
+		}
+	}
+
+	sql := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		name, Table, from.Format(time.RFC3339), to.Format(time.RFC3339),
+	)
+	if err := tx.Exec(sql).Error; err != nil {
+		return fmt.Errorf("creating partition %s: %w", name, err)
+	}
+
+	if stray {
+		result := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", Table, moved))
+		if result.Error != nil {
+			return fmt.Errorf("moving default partition rows of %s: %w", name, result.Error)
+		}
+		log.Printf("Moved %d rows from %s into partition %s", result.RowsAffected, defaultPartition, name)
+	}
+	return nil
+}
+
+// exists reports whether a table with the given name exists, attached or not
+func exists(tx *gorm.DB, name string) (bool, error) {
+	var found bool
+	err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", name).Scan(&found).Error
+	return found, err
+}
+
+// expireDefault applies the retention to rows of the default partition older
+// than cutoff, which belong to days without a daily partition. In archive mode
+// every expired day is moved into its own partition and detached like the
+// daily partitions.
+func expireDefault(tx *gorm.DB, cutoff time.Time) error {
+	if !Archive {
+		result := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE timestamp < ?", defaultPartition), cutoff)
+		if result.Error != nil {
+			return fmt.Errorf("expiring rows of %s: %w", defaultPartition, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired rows from %s", result.RowsAffected, defaultPartition)
+		}
+		return nil
+	}
+
+	var days []time.Time
+	err := tx.Raw(fmt.Sprintf(
+		"SELECT DISTINCT date_trunc('day', timestamp AT TIME ZONE 'UTC') FROM %s WHERE timestamp < ? ORDER BY 1",
+		defaultPartition,
+	), cutoff).Scan(&days).Error
+	if err != nil {
+		return fmt.Errorf("listing expired days of %s: %w", defaultPartition, err)
+	}
+
+	for _, t := range days {
+		name, from, to := bounds(t)
+		found, err := exists(tx, name)
+		if err != nil {
+			return err
+		}
+		if found {
+			// Partisi hari tersebut sudah di-detach sebelumnya, barisnya ditambahkan ke tabel arsip
+			err := tx.Exec(fmt.Sprintf(
+				"WITH moved AS (DELETE FROM %s WHERE timestamp >= ? AND timestamp < ? RETURNING *) INSERT INTO %s SELECT * FROM moved",
+				defaultPartition, name,
+			), from, to).Error
+			if err != nil {
+				return fmt.Errorf("archiving rows of %s into %s: %w", defaultPartition, name, err)
+			}
+			continue
+		}
+
+		if err := create(tx, t); err != nil {
+			return err
+		}
+		if err := expire(tx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the names of the partitions currently attached to Table
+func list(tx *gorm.DB) ([]string, error) {
+	var names []string
+	err := tx.Raw(`
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = ?
+		ORDER BY child.relname`, Table).Scan(&names).Error
+	return names, err
+}
+
+func expire(tx *gorm.DB, name string) error {
+	if Archive {
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", Table, name)).Error; err != nil {
+			return fmt.Errorf("detaching partition %s: %w", name, err)
+		}
+		log.Printf("Detached expired partition %s for archiving", name)
+		return nil
+	}
+
+	if err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", name)).Error; err != nil {
+		return fmt.Errorf("dropping partition %s: %w", name, err)
+	}
+	log.Printf("Dropped expired partition %s", name)
+	return nil
+}
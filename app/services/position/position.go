@@ -0,0 +1,56 @@
+package position
+
+import (
+	"tj_techtest/app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Update moves the current position of each vehicle to its newest location in
+// the list. A stored position with a newer timestamp is kept, so late points
+// never move a vehicle back.
+func Update(tx *gorm.DB, locations []models.VehicleLocation) error {
+	newest := make(map[uint]int)
+	var order []uint
+	for i, location := range locations {
+		j, ok := newest[location.VehicleID]
+		if !ok {
+			order = append(order, location.VehicleID)
+		}
+		if !ok || location.Timestamp.After(locations[j].Timestamp) {
+			newest[location.VehicleID] = i
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	positions := make([]models.VehiclePosition, 0, len(order))
+	for _, vehicleID := range order {
+		positions = append(positions, models.NewVehiclePosition(locations[newest[vehicleID]]))
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "vehicle_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"latitude", "longitude", "timestamp", "speed", "heading", "distance",
+			"reported_speed", "reported_heading", "altitude", "accuracy", "updated_at",
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "vehicle_positions.timestamp < EXCLUDED.timestamp"},
+		}},
+	}).Create(&positions).Error
+}
+
+// UpdateMotion copies recalculated motion values of a location to the current
+// position of its vehicle, if that location is the current position
+func UpdateMotion(tx *gorm.DB, location models.VehicleLocation) error {
+	return tx.Model(&models.VehiclePosition{}).
+		Where("vehicle_id = ? AND timestamp = ?", location.VehicleID, location.Timestamp).
+		Updates(map[string]interface{}{
+			"speed":    location.Speed,
+			"heading":  location.Heading,
+			"distance": location.Distance,
+		}).Error
+}
@@ -0,0 +1,355 @@
+package rollup
+
+import (
+	"context"
+	"log"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// History resolutions accepted by the history endpoint
+const (
+	ResolutionAuto   = "auto"
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+)
+
+const (
+	MinuteTable = "vehicle_location_rollups_1m"
+	HourTable   = "vehicle_location_rollups_1h"
+
+	// dirtyTable holds the minute buckets to rebuild for points stored behind the watermark
+	dirtyTable = "rollup_dirty_buckets"
+
+	watermarkName = "vehicle_locations"
+
+	// chunk bounds how much raw history is aggregated in one transaction
+	chunk = 6 * time.Hour
+
+	// maxSegmentGap ignores the distance between points that are further apart
+	// in time, e.g. across a device being switched off
+	maxSegmentGap = 10 * time.Minute
+)
+
+var (
+	// Interval is how often the rollups are refreshed
+	Interval = config.GetDuration("ROLLUP_INTERVAL", time.Minute)
+
+	// Lookback is how far before the watermark every refresh starts, so points stored
+	// shortly after their minute are included; older ones are marked by MarkDirty
+	Lookback = config.GetDuration("ROLLUP_LOOKBACK", 10*time.Minute)
+
+	// RawMaxWindow and MinuteMaxWindow pick the resolution for ResolutionAuto
+	RawMaxWindow    = config.GetDuration("HISTORY_RAW_MAX_WINDOW", 6*time.Hour)
+	MinuteMaxWindow = config.GetDuration("HISTORY_MINUTE_MAX_WINDOW", 7*24*time.Hour)
+)
+
+// Resolve picks the resolution for a history query. Without a start and end
+// the raw points are returned, as before rollups existed; a window open only at
+// the start is served from the hourly rollup when the resolution is auto.
+func Resolve(resolution string, start, end time.Time) string {
+	if resolution != "" && resolution != ResolutionAuto {
+		return resolution
+	}
+	if start.IsZero() && end.IsZero() {
+		return ResolutionRaw
+	}
+	if start.IsZero() {
+		return ResolutionHour
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	switch window := end.Sub(start); {
+	case window <= RawMaxWindow:
+		return ResolutionRaw
+	case window <= MinuteMaxWindow:
+		return ResolutionMinute
+	default:
+		return ResolutionHour
+	}
+}
+
+// Table returns the rollup table of a resolution
+func Table(resolution string) string {
+	if resolution == ResolutionHour {
+		return HourTable
+	}
+	return MinuteTable
+}
+
+// BucketSize returns the length of a bucket of a resolution
+func BucketSize(resolution string) time.Duration {
+	if resolution == ResolutionHour {
+		return time.Hour
+	}
+	return time.Minute
+}
+
+// Run refreshes the rollups now and then every Interval until ctx is canceled
+func Run(ctx context.Context) {
+	interval := Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Refresh(time.Now()); err != nil {
+			log.Printf("Location rollup failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh aggregates the raw locations between the watermark (minus Lookback)
+// and the start of the current minute into the minute and hour rollups, then
+// rebuilds the buckets marked by MarkDirty
+func Refresh(now time.Time) error {
+	to := now.UTC().Truncate(time.Minute)
+
+	from, err := watermark(to)
+	if err != nil {
+		return err
+	}
+	from = from.Add(-Lookback).Truncate(time.Minute)
+
+	for from.Before(to) {
+		end := from.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			// Serializes refreshes between API instances
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", watermarkName+"_rollup").Error; err != nil {
+				return err
+			}
+			if err := rollupMinutes(tx, from, end, 0); err != nil {
+				return err
+			}
+			if err := rollupHours(tx, from.Truncate(time.Hour), end, 0); err != nil {
+				return err
+			}
+			return tx.Exec(`
+				INSERT INTO rollup_watermarks (name, processed_until) VALUES (?, ?)
+				ON CONFLICT (name) DO UPDATE SET processed_until = GREATEST(rollup_watermarks.processed_until, EXCLUDED.processed_until)`,
+				watermarkName, end).Error
+		})
+		if err != nil {
+			return err
+		}
+		from = end
+	}
+	return refreshDirty()
+}
+
+type dirtyBucket struct {
+	VehicleID uint
+	Bucket    time.Time
+}
+
+// MarkDirty records the minute buckets of stored locations that a refresh may
+// already have passed, e.g. late points or points a device buffered while
+// offline, so the next refresh rebuilds them.
+func MarkDirty(tx *gorm.DB, locations []models.VehicleLocation) error {
+	// Titik setelah batas ini masih tercakup oleh Lookback pada refresh berikutnya
+	covered := time.Now().Add(Interval + time.Minute - Lookback)
+
+	seen := make(map[dirtyBucket]bool)
+	var buckets []dirtyBucket
+	for _, location := range locations {
+		if !location.Timestamp.Before(covered) {
+			continue
+		}
+		bucket := dirtyBucket{location.VehicleID, location.Timestamp.UTC().Truncate(time.Minute)}
+		if !seen[bucket] {
+			seen[bucket] = true
+			buckets = append(buckets, bucket)
+		}
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+	return tx.Table(dirtyTable).Clauses(clause.OnConflict{DoNothing: true}).Create(&buckets).Error
+}
+
+// refreshDirty rebuilds the marked buckets one vehicle at a time
+func refreshDirty() error {
+	var ranges []struct {
+		VehicleID   uint
+		First, Last time.Time
+	}
+	err := config.DB.Raw("SELECT vehicle_id, MIN(bucket) AS first, MAX(bucket) AS last FROM " + dirtyTable + " GROUP BY vehicle_id").
+		Scan(&ranges).Error
+	if err != nil {
+		return err
+	}
+
+	for _, r := range ranges {
+		// The distance and speed of the point after a dirty one are derived from it
+		from := r.First
+		to := r.Last.Add(time.Minute + maxSegmentGap)
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", watermarkName+"_rollup").Error; err != nil {
+				return err
+			}
+			err := tx.Exec("DELETE FROM "+dirtyTable+" WHERE vehicle_id = ? AND bucket BETWEEN ? AND ?", r.VehicleID, r.First, r.Last).Error
+			if err != nil {
+				return err
+			}
+			if err := rollupMinutes(tx, from, to, r.VehicleID); err != nil {
+				return err
+			}
+			return rollupHours(tx, from.Truncate(time.Hour), to.Truncate(time.Hour).Add(time.Hour), r.VehicleID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watermark returns where the previous refresh stopped, or the oldest location on the first run
+func watermark(fallback time.Time) (time.Time, error) {
+	var row struct {
+		ProcessedUntil *time.Time
+	}
+	err := config.DB.Raw("SELECT processed_until FROM rollup_watermarks WHERE name = ?", watermarkName).Scan(&row).Error
+	if err != nil {
+		return fallback, err
+	}
+	if row.ProcessedUntil != nil {
+		return *row.ProcessedUntil, nil
+	}
+
+	err = config.DB.Raw("SELECT MIN(timestamp) AS processed_until FROM vehicle_locations").Scan(&row).Error
+	if err != nil || row.ProcessedUntil == nil {
+		return fallback, err
+	}
+	return *row.ProcessedUntil, nil
+}
+
+// vehicleFilter restricts a rollup query to one vehicle, or to none when vehicleID is 0
+func vehicleFilter(vehicleID uint) string {
+	if vehicleID == 0 {
+		return ""
+	}
+	return " AND vehicle_id = @vehicle_id"
+}
+
+// rollupMinutes rebuilds the minute buckets in [from, to) of the vehicle, or
+// of every vehicle when vehicleID is 0. The speed of a point is the distance
+// from the previous point of the vehicle divided by the time between them; the
+// speed reported by the device is aggregated separately, and the heading is
+// the one of the last point of the bucket.
+func rollupMinutes(tx *gorm.DB, from, to time.Time, vehicleID uint) error {
+	args := map[string]interface{}{
+		"source_from": from.Add(-maxSegmentGap),
+		"from":        from,
+		"to":          to,
+		"max_gap":     maxSegmentGap.Seconds(),
+		"vehicle_id":  vehicleID,
+	}
+	filter := vehicleFilter(vehicleID)
+
+	if err := tx.Exec("DELETE FROM "+MinuteTable+" WHERE bucket >= @from AND bucket < @to"+filter, args).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		WITH points AS (
+			SELECT vehicle_id, latitude, longitude, timestamp, heading, reported_heading, reported_speed,
+				LAG(latitude) OVER w AS prev_latitude,
+				LAG(longitude) OVER w AS prev_longitude,
+				EXTRACT(EPOCH FROM timestamp - LAG(timestamp) OVER w) AS seconds
+			FROM vehicle_locations
+			WHERE timestamp >= @source_from AND timestamp < @to AND vehicle_id IS NOT NULL`+filter+`
+			WINDOW w AS (PARTITION BY vehicle_id ORDER BY timestamp)
+		), segments AS (
+			SELECT vehicle_id, latitude, longitude, timestamp, heading, reported_heading, reported_speed,
+				date_trunc('minute', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,
+				CASE WHEN seconds > 0 AND seconds <= @max_gap THEN seconds END AS seconds,
+				CASE WHEN seconds > 0 AND seconds <= @max_gap THEN
+					2 * 6371000 * ASIN(SQRT(
+						POWER(SIN(RADIANS(latitude - prev_latitude) / 2), 2) +
+						COS(RADIANS(prev_latitude)) * COS(RADIANS(latitude)) *
+						POWER(SIN(RADIANS(longitude - prev_longitude) / 2), 2)
+					))
+				END AS distance
+			FROM points
+			WHERE timestamp >= @from
+		)
+		INSERT INTO `+MinuteTable+` (vehicle_id, bucket, latitude, longitude, last_timestamp,
+			point_count, distance, duration, min_speed, max_speed, avg_speed,
+			heading, reported_heading, reported_speed_count, max_reported_speed, avg_reported_speed)
+		SELECT vehicle_id, bucket,
+			(ARRAY_AGG(latitude ORDER BY timestamp DESC))[1],
+			(ARRAY_AGG(longitude ORDER BY timestamp DESC))[1],
+			MAX(timestamp),
+			COUNT(*),
+			COALESCE(SUM(distance), 0),
+			COALESCE(SUM(seconds), 0),
+			MIN(distance / seconds * 3.6),
+			MAX(distance / seconds * 3.6),
+			SUM(distance) / NULLIF(SUM(seconds), 0) * 3.6,
+			(ARRAY_AGG(heading ORDER BY timestamp DESC))[1],
+			(ARRAY_AGG(reported_heading ORDER BY timestamp DESC))[1],
+			COUNT(reported_speed),
+			MAX(reported_speed),
+			AVG(reported_speed)
+		FROM segments
+		GROUP BY vehicle_id, bucket`, args).Error
+}
+
+// rollupHours rebuilds the hour buckets in [from, to) from the minute buckets,
+// of the vehicle or of every vehicle when vehicleID is 0
+func rollupHours(tx *gorm.DB, from, to time.Time, vehicleID uint) error {
+	args := map[string]interface{}{
+		"from":       from,
+		"to":         to,
+		"vehicle_id": vehicleID,
+	}
+	filter := vehicleFilter(vehicleID)
+
+	if err := tx.Exec("DELETE FROM "+HourTable+" WHERE bucket >= @from AND bucket < @to"+filter, args).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		INSERT INTO `+HourTable+` (vehicle_id, bucket, latitude, longitude, last_timestamp,
+			point_count, distance, duration, min_speed, max_speed, avg_speed,
+			heading, reported_heading, reported_speed_count, max_reported_speed, avg_reported_speed)
+		SELECT vehicle_id,
+			date_trunc('hour', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS hour_bucket,
+			(ARRAY_AGG(latitude ORDER BY last_timestamp DESC))[1],
+			(ARRAY_AGG(longitude ORDER BY last_timestamp DESC))[1],
+			MAX(last_timestamp),
+			SUM(point_count),
+			SUM(distance),
+			SUM(duration),
+			MIN(min_speed),
+			MAX(max_speed),
+			SUM(distance) / NULLIF(SUM(duration), 0) * 3.6,
+			(ARRAY_AGG(heading ORDER BY last_timestamp DESC))[1],
+			(ARRAY_AGG(reported_heading ORDER BY last_timestamp DESC))[1],
+			SUM(reported_speed_count),
+			MAX(max_reported_speed),
+			SUM(avg_reported_speed * reported_speed_count) / NULLIF(SUM(reported_speed_count), 0)
+		FROM `+MinuteTable+`
+		WHERE bucket >= @from AND bucket < @to`+filter+`
+		GROUP BY vehicle_id, hour_bucket`, args).Error
+}
@@ -0,0 +1,34 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	end := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		resolution string
+		start, end time.Time
+		want       string
+	}{
+		{"no window", ResolutionAuto, time.Time{}, time.Time{}, ResolutionRaw},
+		{"no window without resolution", "", time.Time{}, time.Time{}, ResolutionRaw},
+		{"only end", ResolutionAuto, time.Time{}, end, ResolutionHour},
+		{"one hour", ResolutionAuto, end.Add(-time.Hour), end, ResolutionRaw},
+		{"one day", ResolutionAuto, end.Add(-24 * time.Hour), end, ResolutionMinute},
+		{"one month", ResolutionAuto, end.AddDate(0, -1, 0), end, ResolutionHour},
+		{"explicit resolution", ResolutionMinute, time.Time{}, time.Time{}, ResolutionMinute},
+		{"explicit raw", ResolutionRaw, end.AddDate(0, -1, 0), end, ResolutionRaw},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.resolution, tt.start, tt.end); got != tt.want {
+				t.Errorf("Resolve(%q, %v, %v) = %q, want %q", tt.resolution, tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
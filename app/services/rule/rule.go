@@ -0,0 +1,294 @@
+package rule
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	_ "time/tzdata" // zona waktu tersedia walaupun image tidak memiliki tzdata
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/config"
+	"tj_techtest/pkg/rabbitmq"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// RefreshInterval is how often the loaded rules are reloaded from the
+	// database, so changes made through another process are eventually picked up
+	RefreshInterval = config.GetDuration("RULE_REFRESH", time.Minute)
+
+	// TimeZone is the zone the time windows of rules are evaluated in
+	TimeZone = loadTimeZone(config.GetEnv("RULE_TIMEZONE", "Asia/Jakarta"))
+)
+
+func loadTimeZone(name string) *time.Location {
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid RULE_TIMEZONE %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return zone
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// compiled is an enabled rule prepared for evaluation
+type compiled struct {
+	rule       models.Rule
+	vehicles   map[uint]bool
+	start, end int // jendela waktu dalam menit setelah tengah malam
+	window     bool
+}
+
+func compile(rule models.Rule) (*compiled, error) {
+	c := &compiled{rule: rule}
+	if rule.StartTime != nil && rule.EndTime != nil {
+		var err error
+		if c.start, err = ParseClock(*rule.StartTime); err != nil {
+			return nil, err
+		}
+		if c.end, err = ParseClock(*rule.EndTime); err != nil {
+			return nil, err
+		}
+		c.window = true
+	}
+	if len(rule.Vehicles) > 0 {
+		c.vehicles = make(map[uint]bool, len(rule.Vehicles))
+		for _, vehicle := range rule.Vehicles {
+			c.vehicles[vehicle.ID] = true
+		}
+	}
+	return c, nil
+}
+
+// appliesTo reports whether the rule is evaluated for the vehicle. Rules
+// without assigned vehicles apply to the whole fleet.
+func (c *compiled) appliesTo(vehicleID uint) bool {
+	return len(c.vehicles) == 0 || c.vehicles[vehicleID]
+}
+
+// silence returns how long a vehicle has to stay silent for the rule, zero if
+// the rule has no such condition
+func (c *compiled) silence() time.Duration {
+	if c.rule.NoUpdateSeconds == nil {
+		return 0
+	}
+	return time.Duration(*c.rule.NoUpdateSeconds) * time.Second
+}
+
+// matches reports whether the location conditions of the rule hold for the
+// point at the given time. The no update condition is checked by the watchdog.
+func (c *compiled) matches(index *geofence.Index, location models.VehicleLocation, at time.Time) bool {
+	if c.rule.GeofenceID != nil {
+		if index == nil {
+			return false
+		}
+		entry, ok := index.Get(*c.rule.GeofenceID)
+		if !ok || !entry.Contains(location.Latitude, location.Longitude) {
+			return false
+		}
+	}
+
+	if c.window {
+		local := at.In(TimeZone)
+		minute := local.Hour()*60 + local.Minute()
+		// Jendela seperti 22:00-05:00 melewati tengah malam
+		if c.start <= c.end {
+			if minute < c.start || minute >= c.end {
+				return false
+			}
+		} else if minute < c.start && minute >= c.end {
+			return false
+		}
+	}
+
+	if c.rule.SpeedAbove != nil {
+		speed := location.CurrentSpeed()
+		if speed == nil || *speed <= *c.rule.SpeedAbove {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	rulesMu       sync.Mutex
+	loadedRules   []*compiled
+	rulesLoadedAt time.Time
+)
+
+// current returns the enabled rules, loading them on first use and reloading
+// them once RefreshInterval has passed
+func current() ([]*compiled, error) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if !rulesLoadedAt.IsZero() && time.Since(rulesLoadedAt) < RefreshInterval {
+		return loadedRules, nil
+	}
+
+	var rules []models.Rule
+	err := config.DB.Preload("Vehicles").Preload("Geofence").Where("enabled = ?", true).Find(&rules).Error
+	if err != nil {
+		if !rulesLoadedAt.IsZero() {
+			log.Printf("Failed to refresh rules, using previous ones: %v", err)
+			return loadedRules, nil
+		}
+		return nil, err
+	}
+
+	compiledRules := make([]*compiled, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compile(rule)
+		if err != nil {
+			log.Printf("Skipping rule %d: %v", rule.ID, err)
+			continue
+		}
+		compiledRules = append(compiledRules, c)
+	}
+
+	loadedRules = compiledRules
+	rulesLoadedAt = time.Now()
+	return loadedRules, nil
+}
+
+// Reload makes the next evaluation load the rules again after one was
+// created, updated or deleted
+func Reload() {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rulesLoadedAt = time.Time{}
+}
+
+// Evaluate checks the new locations of one vehicle, in time order, against the
+// enabled rules. A rule emits its event once when it starts matching the
+// vehicle and again only after it stopped matching in between. A new location
+// ends the silence of no update rules.
+func Evaluate(tx *gorm.DB, vehicle models.Vehicle, locations []models.VehicleLocation) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	all, err := current()
+	if err != nil {
+		return err
+	}
+	var rules []*compiled
+	var ids []uint
+	for _, c := range all {
+		if c.appliesTo(vehicle.ID) {
+			rules = append(rules, c)
+			ids = append(ids, c.rule.ID)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	index, err := geofence.CurrentIndex()
+	if err != nil {
+		log.Printf("Rules can't check geofences: %v", err)
+	}
+
+	var stored []models.RuleState
+	if err := tx.Where("vehicle_id = ? AND rule_id IN ?", vehicle.ID, ids).Find(&stored).Error; err != nil {
+		return err
+	}
+	states := make(map[uint]models.RuleState, len(stored))
+	for _, state := range stored {
+		states[state.RuleID] = state
+	}
+
+	changed := make(map[uint]bool)
+	var fired []firing
+	for _, location := range locations {
+		for _, c := range rules {
+			state, ok := states[c.rule.ID]
+			if !ok {
+				state = models.RuleState{RuleID: c.rule.ID, VehicleID: vehicle.ID}
+			}
+
+			match := c.silence() == 0 && c.matches(index, location, location.Timestamp)
+			if match == state.Active {
+				continue
+			}
+
+			state.Active = match
+			state.Since = nil
+			if match {
+				since := location.Timestamp
+				state.Since = &since
+				fired = append(fired, firing{c, newEvent(c, vehicle.ID, location, location.Timestamp)})
+			}
+			states[c.rule.ID] = state
+			changed[c.rule.ID] = true
+		}
+	}
+
+	if len(changed) > 0 {
+		updates := make([]models.RuleState, 0, len(changed))
+		for id := range changed {
+			updates = append(updates, states[id])
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&updates).Error; err != nil {
+			return err
+		}
+	}
+	return publish(tx, vehicle, fired)
+}
+
+// firing is a rule that started matching a vehicle
+type firing struct {
+	rule  *compiled
+	event models.RuleEvent
+}
+
+func newEvent(c *compiled, vehicleID uint, location models.VehicleLocation, at time.Time) models.RuleEvent {
+	return models.RuleEvent{
+		RuleID:     c.rule.ID,
+		VehicleID:  vehicleID,
+		GeofenceID: c.rule.GeofenceID,
+		Event:      c.rule.Event,
+		Latitude:   location.Latitude,
+		Longitude:  location.Longitude,
+		Speed:      location.CurrentSpeed(),
+		Timestamp:  at,
+	}
+}
+
+// publish records the rule events and enqueues them to fleet.events through the outbox
+func publish(tx *gorm.DB, vehicle models.Vehicle, fired []firing) error {
+	if len(fired) == 0 {
+		return nil
+	}
+
+	events := make([]models.RuleEvent, len(fired))
+	for i, f := range fired {
+		events[i] = f.event
+	}
+	if err := tx.Create(&events).Error; err != nil {
+		return fmt.Errorf("recording rule events: %w", err)
+	}
+
+	for i, f := range fired {
+		log.Printf("Vehicle %s triggered rule %s (%s)", vehicle.Name, f.rule.rule.Name, events[i].Event)
+
+		message := fleet.NewRuleEvent(vehicle, f.rule.rule, events[i])
+		if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", events[i].Event, message); err != nil {
+			return fmt.Errorf("enqueueing rule event: %w", err)
+		}
+	}
+	return nil
+}
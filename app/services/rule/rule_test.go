@@ -0,0 +1,153 @@
+package rule
+
+import (
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 450, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"7:30", 450, false},
+		{"07:60", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseClock(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClock(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseClock(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesTimeWindow(t *testing.T) {
+	clock := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, TimeZone)
+	}
+	window := func(start, end string) *compiled {
+		c, err := compile(models.Rule{StartTime: &start, EndTime: &end})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	daytime := window("08:00", "17:00")
+	overnight := window("22:00", "05:00")
+
+	tests := []struct {
+		name string
+		rule *compiled
+		at   time.Time
+		want bool
+	}{
+		{"start of window", daytime, clock(8, 0), true},
+		{"inside window", daytime, clock(12, 30), true},
+		{"end is exclusive", daytime, clock(17, 0), false},
+		{"before window", daytime, clock(7, 59), false},
+		{"overnight before midnight", overnight, clock(23, 0), true},
+		{"overnight after midnight", overnight, clock(4, 59), true},
+		{"overnight end is exclusive", overnight, clock(5, 0), false},
+		{"overnight during the day", overnight, clock(12, 0), false},
+		{"window in local time", daytime, clock(9, 0).UTC(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(nil, models.VehicleLocation{}, tt.at); got != tt.want {
+				t.Errorf("matches() at %s = %v, want %v", tt.at.In(TimeZone).Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesConditions(t *testing.T) {
+	index := geofence.NewIndex(geofence.DefaultCellSize)
+	if err := index.Set(models.Geofence{ID: 1, Type: models.GeofenceTypeCircle, Latitude: -6.2, Longitude: 106.8, Radius: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := 60.0
+	geofenceID := uint(1)
+	missing := uint(99)
+	fast, slow := 80.0, 40.0
+	inside := models.VehicleLocation{Latitude: -6.2, Longitude: 106.8, Speed: &fast}
+	outside := models.VehicleLocation{Latitude: -6.3, Longitude: 106.8, Speed: &fast}
+	reportedSlow := models.VehicleLocation{Latitude: -6.2, Longitude: 106.8, Speed: &fast, ReportedSpeed: &slow}
+	noSpeed := models.VehicleLocation{Latitude: -6.2, Longitude: 106.8}
+
+	tests := []struct {
+		name     string
+		rule     models.Rule
+		index    *geofence.Index
+		location models.VehicleLocation
+		want     bool
+	}{
+		{"no conditions", models.Rule{}, index, inside, true},
+		{"inside geofence", models.Rule{GeofenceID: &geofenceID}, index, inside, true},
+		{"outside geofence", models.Rule{GeofenceID: &geofenceID}, index, outside, false},
+		{"unknown geofence", models.Rule{GeofenceID: &missing}, index, inside, false},
+		{"no index", models.Rule{GeofenceID: &geofenceID}, nil, inside, false},
+		{"above speed", models.Rule{SpeedAbove: &limit}, index, inside, true},
+		{"reported speed wins", models.Rule{SpeedAbove: &limit}, index, reportedSlow, false},
+		{"no speed", models.Rule{SpeedAbove: &limit}, index, noSpeed, false},
+		{"speeding inside geofence", models.Rule{GeofenceID: &geofenceID, SpeedAbove: &limit}, index, inside, true},
+		{"speeding outside geofence", models.Rule{GeofenceID: &geofenceID, SpeedAbove: &limit}, index, outside, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compile(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.matches(tt.index, tt.location, time.Now()); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	fleet, err := compile(models.Rule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assigned, err := compile(models.Rule{Vehicles: []models.Vehicle{{ID: 7}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		rule      *compiled
+		vehicleID uint
+		want      bool
+	}{
+		{"whole fleet", fleet, 8, true},
+		{"assigned vehicle", assigned, 7, true},
+		{"other vehicle", assigned, 8, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.appliesTo(tt.vehicleID); got != tt.want {
+				t.Errorf("appliesTo(%d) = %v, want %v", tt.vehicleID, got, tt.want)
+			}
+		})
+	}
+}
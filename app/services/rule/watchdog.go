@@ -0,0 +1,123 @@
+package rule
+
+import (
+	"context"
+	"log"
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CheckInterval is how often no update rules are checked against the current positions
+var CheckInterval = config.GetDuration("RULE_CHECK_INTERVAL", 30*time.Second)
+
+// Run checks the no update rules every CheckInterval until ctx is canceled.
+// Several instances may run at once, a silent vehicle fires a rule only once.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	log.Printf("Rule watchdog started")
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Rule watchdog stopped")
+			return
+		case <-ticker.C:
+			if err := checkSilent(time.Now()); err != nil {
+				log.Printf("Rule watchdog error: %v", err)
+			}
+		}
+	}
+}
+
+// checkSilent fires the no update rules for the vehicles whose latest
+// position is older than the silence of the rule. The other conditions of the
+// rule are checked against that position, with the time window at now.
+func checkSilent(now time.Time) error {
+	rules, err := current()
+	if err != nil {
+		return err
+	}
+
+	var index *geofence.Index
+	for _, c := range rules {
+		silence := c.silence()
+		if silence == 0 {
+			continue
+		}
+		if index == nil {
+			if index, err = geofence.CurrentIndex(); err != nil {
+				log.Printf("Rules can't check geofences: %v", err)
+			}
+		}
+
+		cutoff := now.Add(-silence)
+		query := config.DB.InnerJoins("Vehicle").
+			Joins("LEFT JOIN rule_states ON rule_states.rule_id = ? AND rule_states.vehicle_id = vehicle_positions.vehicle_id", c.rule.ID).
+			Where("vehicle_positions.timestamp < ? AND (rule_states.active IS NULL OR NOT rule_states.active)", cutoff)
+		if len(c.vehicles) > 0 {
+			ids := make([]uint, 0, len(c.vehicles))
+			for id := range c.vehicles {
+				ids = append(ids, id)
+			}
+			query = query.Where("vehicle_positions.vehicle_id IN ?", ids)
+		}
+
+		var positions []models.VehiclePosition
+		if err := query.Find(&positions).Error; err != nil {
+			return err
+		}
+
+		for _, p := range positions {
+			if !c.matches(index, p.Location(), now) {
+				continue
+			}
+			if err := fireSilent(c, p.Vehicle, cutoff, silence); err != nil {
+				log.Printf("Failed to fire rule %d for vehicle %d: %v", c.rule.ID, p.VehicleID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fireSilent activates the rule for the vehicle unless a new location arrived
+// or another instance fired it in the meantime. The event is dated at the
+// moment the silence exceeded the rule.
+func fireSilent(c *compiled, vehicle models.Vehicle, cutoff time.Time, silence time.Duration) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Ingestion locks the position row before it evaluates rules
+		var positions []models.VehiclePosition
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("vehicle_id = ? AND timestamp < ?", vehicle.ID, cutoff).
+			Find(&positions).Error
+		if err != nil || len(positions) == 0 {
+			return err
+		}
+		position := positions[0]
+
+		var states []models.RuleState
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("rule_id = ? AND vehicle_id = ?", c.rule.ID, vehicle.ID).
+			Find(&states).Error
+		if err != nil {
+			return err
+		}
+		if len(states) > 0 && states[0].Active {
+			return nil
+		}
+
+		since := position.Timestamp.Add(silence)
+		state := models.RuleState{RuleID: c.rule.ID, VehicleID: vehicle.ID, Active: true, Since: &since}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&state).Error; err != nil {
+			return err
+		}
+
+		event := newEvent(c, vehicle.ID, position.Location(), since)
+		return publish(tx, vehicle, []firing{{c, event}})
+	})
+}
@@ -0,0 +1,185 @@
+package stop
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
+	"tj_techtest/pkg/rabbitmq"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const Event = "vehicle_idle"
+
+var (
+	// IdleThreshold is how long a vehicle has to stand still before it is recorded as a stop
+	IdleThreshold = config.GetDuration("IDLE_THRESHOLD", 5*time.Minute)
+
+	// IdleRadius is how far (meters) a vehicle may drift from where it stopped, e.g. GPS jitter
+	IdleRadius = config.GetFloat("IDLE_RADIUS", 50)
+)
+
+// detector follows where one vehicle stands still. Points must be added in time order.
+type detector struct {
+	state   models.VehicleStopState
+	started bool // state holds a previous point
+	stop    *models.Stop
+	changed []*models.Stop
+	idle    []*models.Stop // stops that reached the threshold
+}
+
+func (d *detector) add(location models.VehicleLocation) {
+	if !d.started {
+		d.anchor(location)
+		d.started = true
+		return
+	}
+	// Older or duplicate points can't extend the stop
+	if !location.Timestamp.After(d.state.LastTimestamp) {
+		return
+	}
+
+	distance := geo.Distance(d.state.Latitude, d.state.Longitude, location.Latitude, location.Longitude)
+	if distance > IdleRadius {
+		// The stop ends at the last point the vehicle stood still
+		if d.stop != nil {
+			endedAt := d.stop.LastAt
+			d.stop.EndedAt = &endedAt
+			d.markChanged(d.stop)
+			d.stop = nil
+		}
+		d.anchor(location)
+		return
+	}
+
+	d.state.LastTimestamp = location.Timestamp
+	if d.stop == nil {
+		if location.Timestamp.Sub(d.state.Since) < IdleThreshold {
+			return
+		}
+		d.stop = &models.Stop{
+			VehicleID: location.VehicleID,
+			Latitude:  d.state.Latitude,
+			Longitude: d.state.Longitude,
+			StartedAt: d.state.Since,
+		}
+		d.idle = append(d.idle, d.stop)
+	}
+	d.stop.LastAt = location.Timestamp
+	d.stop.DurationSeconds = d.stop.LastAt.Sub(d.stop.StartedAt).Seconds()
+	d.markChanged(d.stop)
+}
+
+// anchor starts a possible stop at the point
+func (d *detector) anchor(location models.VehicleLocation) {
+	d.state.VehicleID = location.VehicleID
+	d.state.Latitude = location.Latitude
+	d.state.Longitude = location.Longitude
+	d.state.Since = location.Timestamp
+	d.state.LastTimestamp = location.Timestamp
+}
+
+func (d *detector) markChanged(stop *models.Stop) {
+	for _, s := range d.changed {
+		if s == stop {
+			return
+		}
+	}
+	d.changed = append(d.changed, stop)
+}
+
+// Track follows the new locations of one vehicle, sorted by timestamp, and
+// records a stop when the vehicle stays within IdleRadius of a point for
+// IdleThreshold. A vehicle_idle event is emitted once per stop, when it
+// reaches the threshold.
+func Track(tx *gorm.DB, vehicle models.Vehicle, locations []models.VehicleLocation) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	d := &detector{}
+	var states []models.VehicleStopState
+	if err := tx.Where("vehicle_id = ?", vehicle.ID).Limit(1).Find(&states).Error; err != nil {
+		return err
+	}
+	if len(states) > 0 {
+		d.state = states[0]
+		d.started = true
+
+		if d.state.StopID != nil {
+			var stop models.Stop
+			err := tx.Where("id = ? AND ended_at IS NULL", *d.state.StopID).Limit(1).Find(&stop).Error
+			if err != nil {
+				return err
+			}
+			if stop.ID != 0 {
+				d.stop = &stop
+			}
+		}
+	}
+
+	for _, location := range locations {
+		d.add(location)
+	}
+
+	var index *geofence.Index
+	if len(d.idle) > 0 {
+		var err error
+		if index, err = geofence.CurrentIndex(); err != nil {
+			return err
+		}
+	}
+	places := make(map[*models.Stop]*models.Geofence, len(d.idle))
+	for _, stop := range d.idle {
+		if place := locate(index, vehicle.ID, stop.Latitude, stop.Longitude); place != nil {
+			stop.InsideGeofence = true
+			stop.GeofenceID = &place.ID
+			places[stop] = place
+		}
+	}
+
+	for _, stop := range d.changed {
+		if err := tx.Omit(clause.Associations).Save(stop).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, stop := range d.idle {
+		place := places[stop]
+		if place != nil {
+			log.Printf("Vehicle %s idle in geofence %s since %v", vehicle.Name, place.Name, stop.StartedAt)
+		} else {
+			log.Printf("Vehicle %s idle outside geofences since %v", vehicle.Name, stop.StartedAt)
+		}
+
+		event := fleet.NewIdleEvent(vehicle, place, Event, *stop)
+		if err := outbox.Enqueue(tx, rabbitmq.GeofenceExchange, "", Event, event); err != nil {
+			return fmt.Errorf("enqueueing idle event: %w", err)
+		}
+	}
+
+	d.state.StopID = nil
+	if d.stop != nil {
+		d.state.StopID = &d.stop.ID
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&d.state).Error
+}
+
+// locate returns the geofence with the lowest ID containing the point, nil if there is none
+func locate(index *geofence.Index, vehicleID uint, lat, lon float64) *models.Geofence {
+	var place *models.Geofence
+	for _, entry := range index.Locate(lat, lon, vehicleID) {
+		if place == nil || entry.Geofence.ID < place.ID {
+			g := entry.Geofence
+			place = &g
+		}
+	}
+	return place
+}
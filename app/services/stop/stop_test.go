@@ -0,0 +1,153 @@
+package stop
+
+import (
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+)
+
+// arrived is when vehicle 7 reaches the spot it parks at in the tests
+var arrived = time.Date(2024, 3, 4, 12, 10, 0, 0, time.UTC)
+
+// ping is a fix of vehicle 7 some time after it arrived, north of the spot by the given meters
+type ping struct {
+	after time.Duration
+	north float64
+}
+
+func (p ping) location() models.VehicleLocation {
+	return models.VehicleLocation{VehicleID: 7, Latitude: -6.2 + p.north/111195, Longitude: 106.8, Timestamp: arrived.Add(p.after)}
+}
+
+func TestDetector(t *testing.T) {
+	tests := []struct {
+		name      string
+		pings     []ping
+		wantIdle  int
+		wantStops int  // stop yang perlu disimpan
+		wantEnded bool // stop terakhir sudah berakhir
+		wantStart time.Duration
+		wantLast  time.Duration
+	}{
+		{
+			name:  "moving",
+			pings: []ping{{0, 0}, {time.Minute, 500}, {2 * time.Minute, 1000}, {IdleThreshold + time.Minute, 1500}},
+		},
+		{
+			name:  "short stop",
+			pings: []ping{{0, 0}, {IdleThreshold / 2, 0}, {IdleThreshold, 500}},
+		},
+		{
+			name:      "idle for the threshold",
+			pings:     []ping{{0, 0}, {time.Minute, 0}, {IdleThreshold, 0}},
+			wantIdle:  1,
+			wantStops: 1,
+			wantLast:  IdleThreshold,
+		},
+		{
+			name:      "gps jitter within the radius",
+			pings:     []ping{{0, 0}, {time.Minute, IdleRadius * 0.8}, {IdleThreshold, -IdleRadius * 0.8}},
+			wantIdle:  1,
+			wantStops: 1,
+			wantLast:  IdleThreshold,
+		},
+		{
+			name:      "stop ends at the last still point",
+			pings:     []ping{{0, 0}, {IdleThreshold, 0}, {IdleThreshold + time.Minute, 0}, {IdleThreshold + 2*time.Minute, 500}},
+			wantIdle:  1,
+			wantStops: 1,
+			wantEnded: true,
+			wantLast:  IdleThreshold + time.Minute,
+		},
+		{
+			name:      "new stop after moving",
+			pings:     []ping{{0, 0}, {time.Minute, 500}, {time.Minute + IdleThreshold, 500}},
+			wantIdle:  1,
+			wantStops: 1,
+			wantStart: time.Minute,
+			wantLast:  time.Minute + IdleThreshold,
+		},
+		{
+			name:  "older and duplicate points are ignored",
+			pings: []ping{{0, 0}, {time.Minute, 0}, {time.Minute, 500}, {30 * time.Second, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &detector{}
+			for _, p := range tt.pings {
+				d.add(p.location())
+			}
+
+			if len(d.idle) != tt.wantIdle {
+				t.Fatalf("%d idle stops, want %d", len(d.idle), tt.wantIdle)
+			}
+			if len(d.changed) != tt.wantStops {
+				t.Fatalf("%d stops to save, want %d", len(d.changed), tt.wantStops)
+			}
+			if tt.wantStops == 0 {
+				return
+			}
+
+			stop := d.changed[len(d.changed)-1]
+			if !stop.StartedAt.Equal(arrived.Add(tt.wantStart)) {
+				t.Errorf("started at %v, want %v", stop.StartedAt, arrived.Add(tt.wantStart))
+			}
+			if !stop.LastAt.Equal(arrived.Add(tt.wantLast)) {
+				t.Errorf("last at %v, want %v", stop.LastAt, arrived.Add(tt.wantLast))
+			}
+			if stop.DurationSeconds != (tt.wantLast - tt.wantStart).Seconds() {
+				t.Errorf("duration %vs, want %vs", stop.DurationSeconds, (tt.wantLast - tt.wantStart).Seconds())
+			}
+			if (stop.EndedAt != nil) != tt.wantEnded {
+				t.Errorf("ended at %v, want ended %v", stop.EndedAt, tt.wantEnded)
+			}
+			if tt.wantEnded && !stop.EndedAt.Equal(stop.LastAt) {
+				t.Errorf("ended at %v, want the last still point %v", stop.EndedAt, stop.LastAt)
+			}
+			if (d.stop == nil) != tt.wantEnded {
+				t.Errorf("open stop = %v, want ended %v", d.stop, tt.wantEnded)
+			}
+		})
+	}
+}
+
+func TestDetectorResumesStoredState(t *testing.T) {
+	state := models.VehicleStopState{VehicleID: 7, Latitude: -6.2, Longitude: 106.8, Since: arrived, LastTimestamp: arrived.Add(time.Minute)}
+
+	t.Run("reaches the threshold", func(t *testing.T) {
+		d := &detector{state: state, started: true}
+		d.add(ping{IdleThreshold, 0}.location())
+
+		if len(d.idle) != 1 || !d.idle[0].StartedAt.Equal(arrived) {
+			t.Fatalf("idle = %+v, want one stop since %v", d.idle, arrived)
+		}
+	})
+
+	t.Run("open stop is extended without a new event", func(t *testing.T) {
+		stop := &models.Stop{ID: 3, VehicleID: 7, StartedAt: arrived, LastAt: arrived.Add(IdleThreshold)}
+		d := &detector{state: state, started: true, stop: stop}
+		d.add(ping{IdleThreshold + time.Minute, 0}.location())
+
+		if len(d.idle) != 0 {
+			t.Errorf("%d idle events, want none", len(d.idle))
+		}
+		if !stop.LastAt.Equal(arrived.Add(IdleThreshold+time.Minute)) || stop.EndedAt != nil {
+			t.Errorf("stop = %+v, want it extended and open", stop)
+		}
+	})
+
+	t.Run("open stop ends when the vehicle moves", func(t *testing.T) {
+		stop := &models.Stop{ID: 3, VehicleID: 7, StartedAt: arrived, LastAt: arrived.Add(IdleThreshold)}
+		d := &detector{state: state, started: true, stop: stop}
+		d.add(ping{IdleThreshold + time.Minute, 500}.location())
+
+		if stop.EndedAt == nil || !stop.EndedAt.Equal(arrived.Add(IdleThreshold)) {
+			t.Errorf("ended at %v, want %v", stop.EndedAt, arrived.Add(IdleThreshold))
+		}
+		if len(d.changed) != 1 || d.stop != nil {
+			t.Errorf("changed = %d, open stop = %v, want the ended stop saved", len(d.changed), d.stop)
+		}
+	})
+}
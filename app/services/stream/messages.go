@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+	"tj_techtest/app/fleet"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/pkg/geo"
+)
+
+// Location is a stored location as pushed to stream clients
+type Location struct {
+	VehicleID   string   `json:"vehicle_id"`
+	VehicleName string   `json:"vehicle_name"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	Timestamp   int64    `json:"timestamp"`
+	Speed       *float64 `json:"speed"`   // dalam km/jam
+	Heading     *float64 `json:"heading"` // dalam derajat
+	Late        bool     `json:"late,omitempty"`
+}
+
+// NewLocation builds the stream message of a stored location. Late points are
+// older than the current position of the vehicle.
+func NewLocation(vehicle models.Vehicle, location models.VehicleLocation, late bool) Location {
+	return Location{
+		VehicleID:   strconv.FormatUint(uint64(vehicle.ID), 10),
+		VehicleName: vehicle.Name,
+		Latitude:    location.Latitude,
+		Longitude:   location.Longitude,
+		Timestamp:   location.Timestamp.Unix(),
+		Speed:       location.Speed,
+		Heading:     location.Heading,
+		Late:        late,
+	}
+}
+
+// AddLocations adds stored locations for the location streams
+func (b *Batch) AddLocations(locations []Location) error {
+	messages := make([]interface{}, len(locations))
+	for i, location := range locations {
+		messages[i] = location
+	}
+	return b.add(LocationChannel, messages)
+}
+
+// AddGeofenceEvents adds recorded geofence events for the event streams
+func (b *Batch) AddGeofenceEvents(events []fleet.GeofenceEvent) error {
+	messages := make([]interface{}, len(events))
+	for i, event := range events {
+		messages[i] = event
+	}
+	return b.add(GeofenceEventChannel, messages)
+}
+
+func decodeLocations(payload []byte) ([]interface{}, error) {
+	var locations []Location
+	if err := json.Unmarshal(payload, &locations); err != nil {
+		return nil, err
+	}
+	messages := make([]interface{}, len(locations))
+	for i, location := range locations {
+		messages[i] = location
+	}
+	return messages, nil
+}
+
+func decodeGeofenceEvents(payload []byte) ([]interface{}, error) {
+	var events []fleet.GeofenceEvent
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return nil, err
+	}
+	messages := make([]interface{}, len(events))
+	for i, event := range events {
+		messages[i] = event
+	}
+	return messages, nil
+}
+
+// LocationFilter selects locations. Empty fields match everything.
+type LocationFilter struct {
+	Vehicles   map[string]bool // ID atau nama kendaraan
+	Box        *geo.Box
+	GeofenceID uint // hanya titik di dalam geofence ini
+}
+
+func (f LocationFilter) match(message interface{}, index *geofence.Index) bool {
+	location, ok := message.(Location)
+	if !ok {
+		return false
+	}
+	if len(f.Vehicles) > 0 && !f.Vehicles[location.VehicleID] && !f.Vehicles[location.VehicleName] {
+		return false
+	}
+	if f.Box != nil && !f.Box.Contains(location.Latitude, location.Longitude) {
+		return false
+	}
+	if f.GeofenceID != 0 {
+		if index == nil {
+			return false
+		}
+		entry, ok := index.Get(f.GeofenceID)
+		if !ok || !entry.Contains(location.Latitude, location.Longitude) {
+			return false
+		}
+	}
+	return true
+}
+
+// GeofenceEventFilter selects geofence events. Empty fields match everything.
+type GeofenceEventFilter struct {
+	Vehicles   map[string]bool // ID atau nama kendaraan
+	GeofenceID uint
+	Events     map[string]bool
+}
+
+func (f GeofenceEventFilter) match(message interface{}, _ *geofence.Index) bool {
+	event, ok := message.(fleet.GeofenceEvent)
+	if !ok {
+		return false
+	}
+	if len(f.Vehicles) > 0 && !f.Vehicles[event.VehicleID] && !f.Vehicles[event.VehicleName] {
+		return false
+	}
+	if f.GeofenceID != 0 && event.GeofenceID != f.GeofenceID {
+		return false
+	}
+	if len(f.Events) > 0 && !f.Events[event.Event] {
+		return false
+	}
+	return true
+}
+
+// SubscribeLocations starts receiving the stored locations matching the filter
+func SubscribeLocations(filter LocationFilter) *Subscription {
+	return subscribe(LocationChannel, filter)
+}
+
+// SubscribeGeofenceEvents starts receiving the geofence events matching the filter
+func SubscribeGeofenceEvents(filter GeofenceEventFilter) *Subscription {
+	return subscribe(GeofenceEventChannel, filter)
+}
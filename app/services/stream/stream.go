@@ -0,0 +1,277 @@
+package stream
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"tj_techtest/app/services/geofence"
+	"tj_techtest/config"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Postgres NOTIFY channels carrying stored data to every API instance
+const (
+	LocationChannel      = "vehicle_locations"
+	GeofenceEventChannel = "geofence_events"
+)
+
+const (
+	// maxPayload keeps notifications below the 8000 byte limit of Postgres
+	maxPayload = 7500
+
+	reconnectDelay = 5 * time.Second
+)
+
+var (
+	// BufferSize is how many messages may wait for a slow client before it is disconnected
+	BufferSize = config.GetInt("STREAM_BUFFER_SIZE", 256)
+
+	// HeartbeatInterval is how often idle stream connections receive a heartbeat
+	HeartbeatInterval = config.GetDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second)
+)
+
+var (
+	// ErrSlowClient closes a subscription that didn't keep up with the stream
+	ErrSlowClient = errors.New("client too slow, stream closed")
+
+	// ErrStreamClosed closes the subscriptions when the server shuts down
+	ErrStreamClosed = errors.New("server shutting down")
+)
+
+// Filter selects the messages a subscription receives
+type Filter interface {
+	match(message interface{}, index *geofence.Index) bool
+}
+
+// Batch collects the locations and geofence events of one ingest batch, so
+// they reach every API instance in a single round trip after the batch committed
+type Batch struct {
+	notifications []interface{} // pasangan channel dan payload
+}
+
+// add splits the messages on the channel into as few notifications as the
+// payload limit allows
+func (b *Batch) add(channel string, messages []interface{}) error {
+	var payload []byte
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if len(payload) > 0 && len(payload)+len(data)+2 > maxPayload {
+			b.notifications = append(b.notifications, channel, string(append(payload, ']')))
+			payload = nil
+		}
+		if len(payload) == 0 {
+			payload = append(payload, '[')
+		} else {
+			payload = append(payload, ',')
+		}
+		payload = append(payload, data...)
+	}
+	if len(payload) > 0 {
+		b.notifications = append(b.notifications, channel, string(append(payload, ']')))
+	}
+	return nil
+}
+
+// Send delivers the collected messages to every API instance. It is called
+// once the data is committed, so clients never see locations or events that
+// were rolled back.
+func (b *Batch) Send(db *gorm.DB) error {
+	if len(b.notifications) == 0 {
+		return nil
+	}
+	rows := strings.TrimSuffix(strings.Repeat("(?, ?),", len(b.notifications)/2), ",")
+	return db.Exec("SELECT pg_notify(channel, payload) FROM (VALUES "+rows+") AS n(channel, payload)", b.notifications...).Error
+}
+
+// Subscription receives the messages matching its filter until it is closed
+type Subscription struct {
+	hub      *registry
+	filter   Filter
+	messages chan interface{}
+	err      error
+}
+
+// Messages returns the channel of matching messages. It is closed when the
+// client was too slow or the server shuts down, see Err.
+func (s *Subscription) Messages() <-chan interface{} {
+	return s.messages
+}
+
+// Err returns why the subscription was closed by the server
+func (s *Subscription) Err() error {
+	s.hub.mu.RLock()
+	defer s.hub.mu.RUnlock()
+	return s.err
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s, nil)
+}
+
+// registry holds the open subscriptions of one channel on this instance
+type registry struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+	decode        func(payload []byte) ([]interface{}, error)
+}
+
+var hubs = map[string]*registry{
+	LocationChannel:      {subscriptions: make(map[*Subscription]struct{}), decode: decodeLocations},
+	GeofenceEventChannel: {subscriptions: make(map[*Subscription]struct{}), decode: decodeGeofenceEvents},
+}
+
+func subscribe(channel string, filter Filter) *Subscription {
+	hub := hubs[channel]
+	s := &Subscription{
+		hub:      hub,
+		filter:   filter,
+		messages: make(chan interface{}, BufferSize),
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closed {
+		s.err = ErrStreamClosed
+		close(s.messages)
+		return s
+	}
+	hub.subscriptions[s] = struct{}{}
+	return s
+}
+
+// remove closes the subscription once; mu must be held for writing
+func (r *registry) remove(s *Subscription, err error) {
+	if _, ok := r.subscriptions[s]; !ok {
+		return
+	}
+	delete(r.subscriptions, s)
+	s.err = err
+	close(s.messages)
+}
+
+// publish hands the messages to the matching subscriptions without blocking.
+// A subscription whose buffer is full is closed, so one stuck client can't
+// hold back the others or ingestion.
+func (r *registry) publish(messages []interface{}) {
+	index, err := geofence.CurrentIndex()
+	if err != nil {
+		log.Printf("Stream can't filter by geofence: %v", err)
+	}
+
+	var slow []*Subscription
+	r.mu.RLock()
+	for s := range r.subscriptions {
+	deliver:
+		for _, message := range messages {
+			if !s.filter.match(message, index) {
+				continue
+			}
+			select {
+			case s.messages <- message:
+			default:
+				slow = append(slow, s)
+				break deliver
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+	r.mu.Lock()
+	for _, s := range slow {
+		r.remove(s, ErrSlowClient)
+	}
+	r.mu.Unlock()
+}
+
+func (r *registry) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for s := range r.subscriptions {
+		r.remove(s, ErrStreamClosed)
+	}
+}
+
+// Run listens for stored locations and geofence events and pushes them to the
+// subscriptions of this instance until ctx is canceled, then closes every subscription
+func Run(ctx context.Context) {
+	defer func() {
+		for _, hub := range hubs {
+			hub.close()
+		}
+	}()
+
+	for {
+		err := listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Stream listener stopped, reconnecting in %v: %v", reconnectDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listen holds a database connection that LISTENs on every channel until ctx
+// is canceled or the connection fails
+func listen(ctx context.Context) error {
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		for channel := range hubs {
+			if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+				return err
+			}
+		}
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				// The connection is still listening, don't hand it back to the pool
+				return fmt.Errorf("%v: %w", err, driver.ErrBadConn)
+			}
+
+			hub, ok := hubs[notification.Channel]
+			if !ok {
+				continue
+			}
+			messages, err := hub.decode([]byte(notification.Payload))
+			if err != nil {
+				log.Printf("Invalid %s stream notification: %v", notification.Channel, err)
+				continue
+			}
+			hub.publish(messages)
+		}
+	})
+}
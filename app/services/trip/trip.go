@@ -0,0 +1,212 @@
+package trip
+
+import (
+	"time"
+	"tj_techtest/app/models"
+	"tj_techtest/config"
+	"tj_techtest/pkg/geo"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// MovingSpeed is the speed (km/h) between two points above which the vehicle is moving
+	MovingSpeed = config.GetFloat("TRIP_MOVING_SPEED", 5)
+
+	// StopDwell is how long a vehicle has to stand still before its trip ends
+	StopDwell = config.GetDuration("TRIP_STOP_DWELL", 5*time.Minute)
+
+	// MaxGap ends the trip when no point arrives for this long, e.g. the device was switched off
+	MaxGap = config.GetDuration("TRIP_MAX_GAP", 30*time.Minute)
+)
+
+// segmenter splits the points of one vehicle into trips. Points must be added in time order.
+type segmenter struct {
+	state   models.VehicleTripState
+	started bool // state holds a previous point
+	trip    *models.Trip
+	changed []*models.Trip
+}
+
+func (s *segmenter) add(location models.VehicleLocation) {
+	if !s.started {
+		s.moveTo(location)
+		s.started = true
+		return
+	}
+	// Older or duplicate points can't extend the track
+	if !location.Timestamp.After(s.state.LastTimestamp) {
+		return
+	}
+
+	elapsed := location.Timestamp.Sub(s.state.LastTimestamp)
+	if elapsed > MaxGap {
+		s.closeTrip()
+		s.moveTo(location)
+		return
+	}
+
+	distance := geo.Distance(s.state.LastLatitude, s.state.LastLongitude, location.Latitude, location.Longitude)
+	speed := distance / elapsed.Seconds() * 3.6 // km/jam
+	moving := speed >= MovingSpeed
+
+	if s.trip == nil {
+		if !moving {
+			s.moveTo(location)
+			return
+		}
+		s.trip = &models.Trip{
+			VehicleID:      location.VehicleID,
+			Status:         models.TripStatusOpen,
+			StartTime:      s.state.LastTimestamp,
+			EndTime:        s.state.LastTimestamp,
+			StartLatitude:  s.state.LastLatitude,
+			StartLongitude: s.state.LastLongitude,
+			EndLatitude:    s.state.LastLatitude,
+			EndLongitude:   s.state.LastLongitude,
+			PointCount:     1,
+		}
+	}
+
+	if moving {
+		// The trip ends at the last moving point, standing still doesn't extend it
+		s.trip.Distance += distance
+		s.trip.EndTime = location.Timestamp
+		s.trip.EndLatitude = location.Latitude
+		s.trip.EndLongitude = location.Longitude
+		s.trip.Duration = s.trip.EndTime.Sub(s.trip.StartTime).Seconds()
+		s.trip.PointCount++
+		if speed > s.trip.MaxSpeed {
+			s.trip.MaxSpeed = speed
+		}
+		s.state.StationarySince = nil
+		s.markChanged(s.trip)
+	} else {
+		if s.state.StationarySince == nil {
+			since := s.state.LastTimestamp
+			s.state.StationarySince = &since
+		}
+		if location.Timestamp.Sub(*s.state.StationarySince) >= StopDwell {
+			s.closeTrip()
+		}
+	}
+
+	s.moveTo(location)
+}
+
+func (s *segmenter) moveTo(location models.VehicleLocation) {
+	s.state.VehicleID = location.VehicleID
+	s.state.LastLatitude = location.Latitude
+	s.state.LastLongitude = location.Longitude
+	s.state.LastTimestamp = location.Timestamp
+}
+
+func (s *segmenter) closeTrip() {
+	if s.trip != nil {
+		s.trip.Status = models.TripStatusClosed
+		s.markChanged(s.trip)
+		s.trip = nil
+	}
+	s.state.StationarySince = nil
+}
+
+func (s *segmenter) markChanged(trip *models.Trip) {
+	for _, t := range s.changed {
+		if t == trip {
+			return
+		}
+	}
+	s.changed = append(s.changed, trip)
+}
+
+// Track extends the trips of a vehicle with new points, sorted by timestamp.
+func Track(tx *gorm.DB, vehicleID uint, locations []models.VehicleLocation) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	s := &segmenter{}
+	var states []models.VehicleTripState
+	if err := tx.Where("vehicle_id = ?", vehicleID).Limit(1).Find(&states).Error; err != nil {
+		return err
+	}
+	if len(states) > 0 {
+		s.state = states[0]
+		s.started = true
+
+		if s.state.TripID != nil {
+			var trip models.Trip
+			err := tx.Where("id = ? AND status = ?", *s.state.TripID, models.TripStatusOpen).Limit(1).Find(&trip).Error
+			if err != nil {
+				return err
+			}
+			if trip.ID != 0 {
+				s.trip = &trip
+			}
+		}
+	}
+
+	for _, location := range locations {
+		s.add(location)
+	}
+
+	for _, trip := range s.changed {
+		if err := tx.Save(trip).Error; err != nil {
+			return err
+		}
+	}
+
+	s.state.TripID = nil
+	if s.trip != nil {
+		s.state.TripID = &s.trip.ID
+	}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&s.state).Error
+}
+
+// Backfill rebuilds the trips of a vehicle from its whole location history,
+// replacing the trips computed so far. Ingestion of the vehicle waits until it is done.
+func Backfill(vehicleID uint) (int, error) {
+	const pageSize = 5000
+	var processed int
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Same lock as geofence evaluation, so new points wait for the rebuild
+		var vehicle models.Vehicle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&vehicle, vehicleID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("vehicle_id = ?", vehicleID).Delete(&models.VehicleTripState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("vehicle_id = ?", vehicleID).Delete(&models.Trip{}).Error; err != nil {
+			return err
+		}
+
+		// Keyset pagination on (timestamp, id) keeps the points in time order
+		var after models.VehicleLocation
+		for {
+			query := tx.Where("vehicle_id = ?", vehicleID)
+			if processed > 0 {
+				query = query.Where("(timestamp, id) > (?, ?)", after.Timestamp, after.ID)
+			}
+
+			var page []models.VehicleLocation
+			if err := query.Order("timestamp ASC, id ASC").Limit(pageSize).Find(&page).Error; err != nil {
+				return err
+			}
+			if len(page) == 0 {
+				return nil
+			}
+
+			if err := Track(tx, vehicleID, page); err != nil {
+				return err
+			}
+			processed += len(page)
+			after = page[len(page)-1]
+		}
+	})
+
+	return processed, err
+}
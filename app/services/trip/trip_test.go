@@ -0,0 +1,138 @@
+package trip
+
+import (
+	"math"
+	"testing"
+	"time"
+	"tj_techtest/app/models"
+)
+
+// route builds the track of vehicle 7 driving north from its depot
+type route struct {
+	start  time.Time
+	at     time.Duration // waktu titik terakhir sejak start
+	north  float64       // posisi titik terakhir dalam meter ke utara dari depot
+	points []models.VehicleLocation
+}
+
+func newRoute() *route {
+	r := &route{start: time.Date(2024, 3, 4, 6, 30, 0, 0, time.UTC)}
+	r.point(0, 0)
+	return r
+}
+
+// point adds a fix at the given time and position without moving the route on
+func (r *route) point(at time.Duration, north float64) *route {
+	r.points = append(r.points, models.VehicleLocation{VehicleID: 7, Latitude: -6.2 + north/111195, Longitude: 106.8, Timestamp: r.start.Add(at)})
+	return r
+}
+
+// move adds a fix d after the last one, meters further north
+func (r *route) move(d time.Duration, meters float64) *route {
+	r.at += d
+	r.north += meters
+	return r.point(r.at, r.north)
+}
+
+// drive adds one fix a minute, 500 m apart (about 30 km/h)
+func (r *route) drive(minutes int) *route {
+	for i := 0; i < minutes; i++ {
+		r.move(time.Minute, 500)
+	}
+	return r
+}
+
+func TestSegmenter(t *testing.T) {
+	type want struct {
+		status   string
+		start    time.Duration
+		end      time.Duration
+		distance float64
+		points   int
+	}
+
+	tests := []struct {
+		name  string
+		route *route
+		want  []want
+	}{
+		{
+			name:  "parked",
+			route: newRoute().move(time.Minute, 1).move(9*time.Minute, 1),
+		},
+		{
+			name:  "driving",
+			route: newRoute().drive(3),
+			want:  []want{{models.TripStatusOpen, 0, 3 * time.Minute, 1500, 4}},
+		},
+		{
+			name:  "trip ends after standing still for StopDwell",
+			route: newRoute().drive(2).move(StopDwell, 0),
+			want:  []want{{models.TripStatusClosed, 0, 2 * time.Minute, 1000, 3}},
+		},
+		{
+			name:  "short stop doesn't end the trip",
+			route: newRoute().drive(2).move(StopDwell/2, 0).drive(1),
+			want:  []want{{models.TripStatusOpen, 0, 3*time.Minute + StopDwell/2, 1500, 4}},
+		},
+		{
+			name:  "gap ends the trip",
+			route: newRoute().drive(2).move(MaxGap+time.Minute, 4000).drive(1),
+			want: []want{
+				{models.TripStatusClosed, 0, 2 * time.Minute, 1000, 3},
+				{models.TripStatusOpen, 2*time.Minute + MaxGap + time.Minute, 3*time.Minute + MaxGap + time.Minute, 500, 2},
+			},
+		},
+		{
+			name:  "older and duplicate points are ignored",
+			route: newRoute().drive(2).point(time.Minute, 9000).point(30*time.Second, 0),
+			want:  []want{{models.TripStatusOpen, 0, 2 * time.Minute, 1000, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &segmenter{}
+			for _, point := range tt.route.points {
+				s.add(point)
+			}
+
+			if len(s.changed) != len(tt.want) {
+				t.Fatalf("%d trips, want %d", len(s.changed), len(tt.want))
+			}
+			for i, trip := range s.changed {
+				w := tt.want[i]
+				start, end := tt.route.start.Add(w.start), tt.route.start.Add(w.end)
+				if trip.Status != w.status {
+					t.Errorf("trip %d status %q, want %q", i, trip.Status, w.status)
+				}
+				if !trip.StartTime.Equal(start) || !trip.EndTime.Equal(end) {
+					t.Errorf("trip %d from %v to %v, want %v to %v", i, trip.StartTime, trip.EndTime, start, end)
+				}
+				if math.Abs(trip.Distance-w.distance) > 1 {
+					t.Errorf("trip %d distance %.1f m, want %.0f m", i, trip.Distance, w.distance)
+				}
+				if trip.PointCount != w.points {
+					t.Errorf("trip %d has %d points, want %d", i, trip.PointCount, w.points)
+				}
+				if trip.Duration != (w.end - w.start).Seconds() {
+					t.Errorf("trip %d duration %vs, want %vs", i, trip.Duration, (w.end - w.start).Seconds())
+				}
+			}
+		})
+	}
+}
+
+func TestSegmenterMaxSpeed(t *testing.T) {
+	// 500 m per menit (30 km/jam), lalu 1 km per menit (60 km/jam)
+	r := newRoute().move(time.Minute, 500).move(time.Minute, 1000)
+
+	s := &segmenter{}
+	for _, point := range r.points {
+		s.add(point)
+	}
+
+	if s.trip == nil || math.Abs(s.trip.MaxSpeed-60) > 0.1 {
+		t.Fatalf("trip = %+v, want max speed 60 km/h", s.trip)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"time"
+)
+
+// GetEnv returns the value of an environment variable or the fallback if unset
+func GetEnv(key, fallback string) string {
+	return getEnv(key, fallback)
+}
+
+// GetDuration parses a duration (e.g. "5m", "30s") from an environment variable
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using default %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// GetInt parses an integer from an environment variable
+func GetInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using default %d", key, value, fallback)
+		return fallback
+	}
+	return number
+}
+
+// GetFloat parses a floating point number from an environment variable
+func GetFloat(key string, fallback float64) float64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s (%q), using default %g", key, value, fallback)
+		return fallback
+	}
+	return number
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS vehicle_geofence_states (
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    geofence_id INTEGER NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    inside BOOLEAN NOT NULL DEFAULT FALSE,
+    entered_at TIMESTAMP WITH TIME ZONE,
+    dwell_notified BOOLEAN NOT NULL DEFAULT FALSE,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (vehicle_id, geofence_id)
+);
+
+CREATE INDEX idx_vehicle_geofence_states_geofence_id ON vehicle_geofence_states(geofence_id);
@@ -0,0 +1,6 @@
+DELETE FROM geofences WHERE type <> 'circle';
+
+ALTER TABLE geofences
+DROP CONSTRAINT IF EXISTS chk_geofences_geometry,
+DROP COLUMN IF EXISTS geometry,
+DROP COLUMN IF EXISTS type;
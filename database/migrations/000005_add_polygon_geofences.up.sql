@@ -0,0 +1,7 @@
+ALTER TABLE geofences
+ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'circle',
+ADD COLUMN geometry JSONB;
+
+-- Polygon geofences store their shape as GeoJSON; latitude/longitude/radius stay 0
+ALTER TABLE geofences
+ADD CONSTRAINT chk_geofences_geometry CHECK (type = 'circle' OR geometry IS NOT NULL);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS geofence_vehicles;
+
+DELETE FROM geofences WHERE type = 'corridor';
+
+ALTER TABLE geofences DROP CONSTRAINT IF EXISTS chk_geofences_geometry;
+ALTER TABLE geofences
+ADD CONSTRAINT chk_geofences_geometry CHECK (type = 'circle' OR geometry IS NOT NULL);
+
+ALTER TABLE geofences DROP COLUMN IF EXISTS buffer;
@@ -0,0 +1,19 @@
+ALTER TABLE geofences
+ADD COLUMN buffer DOUBLE PRECISION NOT NULL DEFAULT 0; -- dalam meter, untuk tipe corridor
+
+ALTER TABLE geofences DROP CONSTRAINT IF EXISTS chk_geofences_geometry;
+ALTER TABLE geofences
+ADD CONSTRAINT chk_geofences_geometry CHECK (
+    type = 'circle'
+    OR (type = 'polygon' AND geometry IS NOT NULL)
+    OR (type = 'corridor' AND geometry IS NOT NULL AND buffer > 0)
+);
+
+-- Kendaraan yang ditugaskan ke sebuah geofence (misalnya koridor rute bus)
+CREATE TABLE IF NOT EXISTS geofence_vehicles (
+    geofence_id INTEGER NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    PRIMARY KEY (geofence_id, vehicle_id)
+);
+
+CREATE INDEX idx_geofence_vehicles_vehicle_id ON geofence_vehicles(vehicle_id);
@@ -0,0 +1,24 @@
+CREATE TABLE vehicle_locations_unpartitioned (
+    id SERIAL PRIMARY KEY,
+    vehicle_id INTEGER,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_vehicle_locations_vehicle FOREIGN KEY (vehicle_id) REFERENCES vehicles(id) ON DELETE CASCADE
+);
+
+INSERT INTO vehicle_locations_unpartitioned (id, vehicle_id, latitude, longitude, timestamp)
+SELECT id, vehicle_id, latitude, longitude, timestamp
+FROM vehicle_locations;
+
+SELECT setval('vehicle_locations_unpartitioned_id_seq', COALESCE((SELECT MAX(id) FROM vehicle_locations_unpartitioned), 0) + 1, false);
+
+-- Partisi yang sudah di-detach untuk arsip tidak ikut terhapus
+DROP TABLE vehicle_locations;
+
+ALTER TABLE vehicle_locations_unpartitioned RENAME TO vehicle_locations;
+ALTER TABLE vehicle_locations RENAME CONSTRAINT vehicle_locations_unpartitioned_pkey TO vehicle_locations_pkey;
+ALTER SEQUENCE vehicle_locations_unpartitioned_id_seq RENAME TO vehicle_locations_id_seq;
+
+CREATE INDEX idx_vehicle_locations_vehicle_id ON vehicle_locations(vehicle_id);
+CREATE INDEX idx_vehicle_locations_timestamp ON vehicle_locations(timestamp);
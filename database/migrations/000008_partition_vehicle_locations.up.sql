@@ -0,0 +1,56 @@
+-- vehicle_locations dipartisi per hari (UTC) berdasarkan timestamp.
+-- Partisi berikutnya dibuat dan partisi lama dihapus oleh job maintenance
+-- di app/services/partition.
+ALTER TABLE vehicle_locations RENAME TO vehicle_locations_old;
+ALTER TABLE vehicle_locations_old RENAME CONSTRAINT vehicle_locations_pkey TO vehicle_locations_old_pkey;
+ALTER SEQUENCE vehicle_locations_id_seq RENAME TO vehicle_locations_old_id_seq;
+ALTER INDEX idx_vehicle_locations_vehicle_id RENAME TO idx_vehicle_locations_old_vehicle_id;
+ALTER INDEX idx_vehicle_locations_timestamp RENAME TO idx_vehicle_locations_old_timestamp;
+
+CREATE TABLE vehicle_locations (
+    id BIGSERIAL,
+    vehicle_id INTEGER,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Primary key pada tabel partisi harus memuat kolom partisi
+    PRIMARY KEY (id, timestamp),
+    CONSTRAINT fk_vehicle_locations_vehicle FOREIGN KEY (vehicle_id) REFERENCES vehicles(id) ON DELETE CASCADE
+) PARTITION BY RANGE (timestamp);
+
+CREATE INDEX idx_vehicle_locations_vehicle_id_timestamp ON vehicle_locations(vehicle_id, timestamp);
+CREATE INDEX idx_vehicle_locations_timestamp ON vehicle_locations(timestamp);
+
+-- Menampung data di luar rentang partisi harian (misalnya timestamp yang sangat lama)
+CREATE TABLE vehicle_locations_default PARTITION OF vehicle_locations DEFAULT;
+
+-- Partisi untuk setiap hari yang memiliki data, ditambah hari ini sampai 7 hari ke depan
+DO $$
+DECLARE
+    day DATE;
+BEGIN
+    FOR day IN
+        SELECT DISTINCT (COALESCE(timestamp, CURRENT_TIMESTAMP) AT TIME ZONE 'UTC')::date FROM vehicle_locations_old
+        UNION
+        SELECT generate_series(
+            (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date,
+            (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::date + 7,
+            INTERVAL '1 day'
+        )::date
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF vehicle_locations FOR VALUES FROM (%L) TO (%L)',
+            'vehicle_locations_p' || to_char(day, 'YYYYMMDD'),
+            day::timestamp AT TIME ZONE 'UTC',
+            (day + 1)::timestamp AT TIME ZONE 'UTC'
+        );
+    END LOOP;
+END $$;
+
+INSERT INTO vehicle_locations (id, vehicle_id, latitude, longitude, timestamp)
+SELECT id, vehicle_id, latitude, longitude, COALESCE(timestamp, CURRENT_TIMESTAMP)
+FROM vehicle_locations_old;
+
+SELECT setval('vehicle_locations_id_seq', COALESCE((SELECT MAX(id) FROM vehicle_locations), 0) + 1, false);
+
+DROP TABLE vehicle_locations_old;
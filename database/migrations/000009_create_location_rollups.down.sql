@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rollup_watermarks;
+DROP TABLE IF EXISTS vehicle_location_rollups_1h;
+DROP TABLE IF EXISTS vehicle_location_rollups_1m;
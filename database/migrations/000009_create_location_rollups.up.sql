@@ -0,0 +1,40 @@
+-- Ringkasan riwayat lokasi per menit dan per jam untuk query rentang panjang.
+-- Diisi oleh job di app/services/rollup. Kecepatan dalam km/jam, jarak dalam meter.
+CREATE TABLE IF NOT EXISTS vehicle_location_rollups_1m (
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    last_timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    point_count INTEGER NOT NULL,
+    distance DOUBLE PRECISION NOT NULL DEFAULT 0,
+    duration DOUBLE PRECISION NOT NULL DEFAULT 0, -- dalam detik
+    min_speed DOUBLE PRECISION,
+    max_speed DOUBLE PRECISION,
+    avg_speed DOUBLE PRECISION,
+    PRIMARY KEY (vehicle_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS vehicle_location_rollups_1h (
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    last_timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    point_count INTEGER NOT NULL,
+    distance DOUBLE PRECISION NOT NULL DEFAULT 0,
+    duration DOUBLE PRECISION NOT NULL DEFAULT 0, -- dalam detik
+    min_speed DOUBLE PRECISION,
+    max_speed DOUBLE PRECISION,
+    avg_speed DOUBLE PRECISION,
+    PRIMARY KEY (vehicle_id, bucket)
+);
+
+CREATE INDEX idx_vehicle_location_rollups_1m_bucket ON vehicle_location_rollups_1m(bucket);
+CREATE INDEX idx_vehicle_location_rollups_1h_bucket ON vehicle_location_rollups_1h(bucket);
+
+-- Batas waktu yang sudah diproses oleh job rollup
+CREATE TABLE IF NOT EXISTS rollup_watermarks (
+    name VARCHAR(100) PRIMARY KEY,
+    processed_until TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS vehicle_trip_states;
+DROP TABLE IF EXISTS trips;
@@ -0,0 +1,32 @@
+-- Perjalanan kendaraan hasil segmentasi riwayat lokasi (app/services/trip)
+CREATE TABLE IF NOT EXISTS trips (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, closed
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    start_latitude DOUBLE PRECISION NOT NULL,
+    start_longitude DOUBLE PRECISION NOT NULL,
+    end_latitude DOUBLE PRECISION NOT NULL,
+    end_longitude DOUBLE PRECISION NOT NULL,
+    distance DOUBLE PRECISION NOT NULL DEFAULT 0, -- dalam meter
+    duration DOUBLE PRECISION NOT NULL DEFAULT 0, -- dalam detik
+    max_speed DOUBLE PRECISION NOT NULL DEFAULT 0, -- dalam km/jam
+    point_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_trips_vehicle_id_start_time ON trips(vehicle_id, start_time);
+
+-- Posisi terakhir dan perjalanan yang sedang berlangsung per kendaraan,
+-- agar segmentasi dapat dilanjutkan saat titik baru datang
+CREATE TABLE IF NOT EXISTS vehicle_trip_states (
+    vehicle_id INTEGER PRIMARY KEY REFERENCES vehicles(id) ON DELETE CASCADE,
+    trip_id BIGINT REFERENCES trips(id) ON DELETE SET NULL,
+    last_latitude DOUBLE PRECISION NOT NULL,
+    last_longitude DOUBLE PRECISION NOT NULL,
+    last_timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    stationary_since TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
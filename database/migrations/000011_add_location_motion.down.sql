@@ -0,0 +1,7 @@
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS accuracy;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS altitude;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS reported_heading;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS reported_speed;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS distance;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS heading;
+ALTER TABLE vehicle_locations DROP COLUMN IF EXISTS speed;
@@ -0,0 +1,10 @@
+-- Dihitung saat ingestion terhadap titik sebelumnya dari kendaraan yang sama
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS speed DOUBLE PRECISION; -- dalam km/jam
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS heading DOUBLE PRECISION; -- dalam derajat, 0 = utara
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS distance DOUBLE PRECISION; -- dalam meter dari titik sebelumnya
+
+-- Dikirim oleh perangkat jika tersedia
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS reported_speed DOUBLE PRECISION; -- dalam km/jam
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS reported_heading DOUBLE PRECISION; -- dalam derajat
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS altitude DOUBLE PRECISION; -- dalam meter
+ALTER TABLE vehicle_locations ADD COLUMN IF NOT EXISTS accuracy DOUBLE PRECISION; -- dalam meter
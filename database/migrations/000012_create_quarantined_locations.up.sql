@@ -0,0 +1,16 @@
+-- Titik lokasi yang ditolak oleh filter ingestion, disimpan untuk audit
+CREATE TABLE IF NOT EXISTS quarantined_locations (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER REFERENCES vehicles(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason VARCHAR(50) NOT NULL, -- out_of_range, null_island, duplicate_timestamp, out_of_order, impossible_speed
+    previous_latitude DOUBLE PRECISION,
+    previous_longitude DOUBLE PRECISION,
+    previous_timestamp TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_quarantined_locations_vehicle_id_timestamp ON quarantined_locations(vehicle_id, timestamp);
+CREATE INDEX idx_quarantined_locations_reason ON quarantined_locations(reason);
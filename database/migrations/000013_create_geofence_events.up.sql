@@ -0,0 +1,16 @@
+-- Riwayat transisi geofence per kendaraan, diurutkan berdasarkan timestamp titik lokasi.
+-- Titik yang terlambat datang memicu evaluasi ulang, sehingga event pada jendela waktu tersebut ditulis ulang.
+CREATE TABLE IF NOT EXISTS geofence_events (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    geofence_id INTEGER NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL, -- geofence_entry, geofence_exit, geofence_dwell, corridor_deviation, corridor_return
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    distance DOUBLE PRECISION, -- dalam meter, hanya untuk tipe corridor
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_geofence_events_vehicle_id_timestamp ON geofence_events(vehicle_id, timestamp);
+CREATE INDEX idx_geofence_events_geofence_id_timestamp ON geofence_events(geofence_id, timestamp);
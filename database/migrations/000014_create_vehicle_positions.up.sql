@@ -0,0 +1,24 @@
+-- Posisi terkini setiap kendaraan, diperbarui saat ingestion agar lokasi terakhir
+-- tidak perlu dicari dari vehicle_locations
+CREATE TABLE IF NOT EXISTS vehicle_positions (
+    vehicle_id INTEGER PRIMARY KEY REFERENCES vehicles(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    speed DOUBLE PRECISION, -- dalam km/jam
+    heading DOUBLE PRECISION, -- dalam derajat
+    distance DOUBLE PRECISION, -- dalam meter
+    reported_speed DOUBLE PRECISION,
+    reported_heading DOUBLE PRECISION,
+    altitude DOUBLE PRECISION,
+    accuracy DOUBLE PRECISION,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO vehicle_positions (vehicle_id, latitude, longitude, timestamp, speed, heading, distance,
+    reported_speed, reported_heading, altitude, accuracy)
+SELECT DISTINCT ON (vehicle_id) vehicle_id, latitude, longitude, timestamp, speed, heading, distance,
+    reported_speed, reported_heading, altitude, accuracy
+FROM vehicle_locations
+WHERE vehicle_id IS NOT NULL
+ORDER BY vehicle_id, timestamp DESC, id DESC;
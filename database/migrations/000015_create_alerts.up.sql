@@ -0,0 +1,24 @@
+-- Alert yang harus ditangani dispatcher, dibuat oleh geofence worker dari event di fleet.events.
+-- Status berjalan dari open -> acknowledged -> resolved; siapa dan kapan dicatat untuk audit.
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    geofence_id INTEGER REFERENCES geofences(id) ON DELETE CASCADE,
+    geofence_event_id BIGINT UNIQUE, -- ID di geofence_events, mencegah alert ganda saat event dikirim ulang
+    event VARCHAR(50) NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL, -- waktu event
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, acknowledged, resolved
+    assignee VARCHAR(255),
+    notes TEXT,
+    acknowledged_by VARCHAR(255),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    resolved_by VARCHAR(255),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alerts_status_timestamp ON alerts(status, timestamp);
+CREATE INDEX idx_alerts_vehicle_id_timestamp ON alerts(vehicle_id, timestamp);
@@ -0,0 +1,7 @@
+ALTER TABLE alerts DROP COLUMN IF EXISTS rule_event_id;
+ALTER TABLE alerts DROP COLUMN IF EXISTS rule_id;
+
+DROP TABLE IF EXISTS rule_events;
+DROP TABLE IF EXISTS rule_states;
+DROP TABLE IF EXISTS rule_vehicles;
+DROP TABLE IF EXISTS rules;
@@ -0,0 +1,64 @@
+-- Aturan alert yang didefinisikan operator melalui API. Semua kondisi yang diisi harus terpenuhi
+-- (AND); event dikirim sekali saat aturan mulai terpenuhi untuk sebuah kendaraan.
+CREATE TABLE IF NOT EXISTS rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    event VARCHAR(50) NOT NULL, -- tipe event yang dipublish ke fleet.events
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    geofence_id INTEGER REFERENCES geofences(id) ON DELETE CASCADE, -- kendaraan berada di dalam geofence
+    start_time VARCHAR(5), -- HH:MM waktu lokal, jendela waktu boleh melewati tengah malam
+    end_time VARCHAR(5),
+    speed_above DOUBLE PRECISION, -- dalam km/jam
+    no_update_seconds INTEGER, -- tidak ada lokasi baru selama durasi ini
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT chk_rules_time_window CHECK ((start_time IS NULL) = (end_time IS NULL)),
+    CONSTRAINT chk_rules_condition CHECK (
+        geofence_id IS NOT NULL OR start_time IS NOT NULL OR speed_above IS NOT NULL OR no_update_seconds IS NOT NULL
+    )
+);
+
+CREATE INDEX idx_rules_deleted_at ON rules(deleted_at);
+
+-- Kendaraan yang dievaluasi oleh sebuah aturan; tanpa kendaraan berarti seluruh armada
+CREATE TABLE IF NOT EXISTS rule_vehicles (
+    rule_id INTEGER NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    PRIMARY KEY (rule_id, vehicle_id)
+);
+
+CREATE INDEX idx_rule_vehicles_vehicle_id ON rule_vehicles(vehicle_id);
+
+-- Apakah aturan sedang terpenuhi untuk kendaraan, agar event tidak dikirim setiap titik
+CREATE TABLE IF NOT EXISTS rule_states (
+    rule_id INTEGER NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT FALSE,
+    since TIMESTAMP WITH TIME ZONE, -- sejak kapan aturan terpenuhi
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rule_id, vehicle_id)
+);
+
+CREATE INDEX idx_rule_states_vehicle_id ON rule_states(vehicle_id);
+
+-- Riwayat event yang dihasilkan aturan
+CREATE TABLE IF NOT EXISTS rule_events (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES rules(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    geofence_id INTEGER REFERENCES geofences(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    speed DOUBLE PRECISION, -- dalam km/jam
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rule_events_rule_id_timestamp ON rule_events(rule_id, timestamp);
+CREATE INDEX idx_rule_events_vehicle_id_timestamp ON rule_events(vehicle_id, timestamp);
+
+-- Alert juga dibuat dari event aturan
+ALTER TABLE alerts ADD COLUMN rule_id INTEGER REFERENCES rules(id) ON DELETE CASCADE;
+ALTER TABLE alerts ADD COLUMN rule_event_id BIGINT UNIQUE; -- ID di rule_events
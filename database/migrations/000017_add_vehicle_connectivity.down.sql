@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_vehicle_positions_online_timestamp;
+
+ALTER TABLE vehicle_positions DROP COLUMN IF EXISTS offline_since;
+ALTER TABLE vehicle_positions DROP COLUMN IF EXISTS offline;
+
+ALTER TABLE vehicles DROP COLUMN IF EXISTS offline_after_seconds;
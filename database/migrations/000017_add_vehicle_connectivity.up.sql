@@ -0,0 +1,8 @@
+-- Batas waktu tanpa lokasi baru sebelum kendaraan dianggap offline; kosong berarti memakai VEHICLE_OFFLINE_AFTER
+ALTER TABLE vehicles ADD COLUMN offline_after_seconds INTEGER CHECK (offline_after_seconds > 0);
+
+-- Status konektivitas disimpan bersama posisi terkini, sehingga event offline/online hanya dikirim saat status berubah
+ALTER TABLE vehicle_positions ADD COLUMN offline BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE vehicle_positions ADD COLUMN offline_since TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_vehicle_positions_online_timestamp ON vehicle_positions(timestamp) WHERE NOT offline;
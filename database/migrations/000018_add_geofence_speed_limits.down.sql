@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS overspeed_violations;
+
+ALTER TABLE geofences DROP COLUMN IF EXISTS speed_limit;
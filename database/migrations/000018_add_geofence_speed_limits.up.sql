@@ -0,0 +1,25 @@
+-- Batas kecepatan per zona (depo, area sekolah, jalur busway), kosong berarti tanpa batas
+ALTER TABLE geofences ADD COLUMN speed_limit DOUBLE PRECISION CHECK (speed_limit > 0); -- dalam km/jam
+
+-- Pelanggaran batas kecepatan di dalam geofence. Baris dibuat saat kendaraan mulai melebihi batas
+-- dan diperbarui selama pelanggaran berlangsung; pelanggaran yang lebih singkat dari
+-- OVERSPEED_MIN_DURATION dihapus kembali. ended_at kosong berarti pelanggaran masih berlangsung.
+CREATE TABLE IF NOT EXISTS overspeed_violations (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    geofence_id INTEGER NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    speed_limit DOUBLE PRECISION NOT NULL, -- batas saat pelanggaran dimulai, dalam km/jam
+    peak_speed DOUBLE PRECISION NOT NULL, -- dalam km/jam
+    latitude DOUBLE PRECISION NOT NULL, -- posisi saat kecepatan puncak
+    longitude DOUBLE PRECISION NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_at TIMESTAMP WITH TIME ZONE NOT NULL, -- titik terakhir yang melebihi batas
+    ended_at TIMESTAMP WITH TIME ZONE,
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    notified BOOLEAN NOT NULL DEFAULT FALSE, -- event overspeed sudah dikirim
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_overspeed_violations_open ON overspeed_violations(vehicle_id, geofence_id) WHERE ended_at IS NULL;
+CREATE INDEX idx_overspeed_violations_geofence_id_started_at ON overspeed_violations(geofence_id, started_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS vehicle_stop_states;
+DROP TABLE IF EXISTS stops;
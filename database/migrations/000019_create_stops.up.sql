@@ -0,0 +1,30 @@
+-- Kendaraan yang diam lebih lama dari IDLE_THRESHOLD (app/services/stop).
+-- ended_at kosong berarti kendaraan masih diam pada titik terakhir yang dilaporkan.
+CREATE TABLE IF NOT EXISTS stops (
+    id BIGSERIAL PRIMARY KEY,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    latitude DOUBLE PRECISION NOT NULL, -- titik pertama saat kendaraan berhenti
+    longitude DOUBLE PRECISION NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_at TIMESTAMP WITH TIME ZONE NOT NULL, -- titik diam terakhir
+    ended_at TIMESTAMP WITH TIME ZONE,
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    inside_geofence BOOLEAN NOT NULL DEFAULT FALSE,
+    geofence_id INTEGER REFERENCES geofences(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stops_vehicle_id_started_at ON stops(vehicle_id, started_at);
+
+-- Titik awal periode diam yang sedang berlangsung per kendaraan, termasuk yang
+-- belum mencapai IDLE_THRESHOLD sehingga belum tercatat di stops
+CREATE TABLE IF NOT EXISTS vehicle_stop_states (
+    vehicle_id INTEGER PRIMARY KEY REFERENCES vehicles(id) ON DELETE CASCADE,
+    stop_id BIGINT REFERENCES stops(id) ON DELETE SET NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    since TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
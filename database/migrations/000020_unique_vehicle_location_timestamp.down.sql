@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_vehicle_locations_vehicle_id_timestamp;
+CREATE INDEX idx_vehicle_locations_vehicle_id_timestamp ON vehicle_locations(vehicle_id, timestamp);
@@ -0,0 +1,8 @@
+-- Satu titik per kendaraan per timestamp. Duplikat yang sudah tersimpan dihapus,
+-- titik dengan id terkecil (yang pertama diterima) dipertahankan.
+DELETE FROM vehicle_locations a
+USING vehicle_locations b
+WHERE a.vehicle_id = b.vehicle_id AND a.timestamp = b.timestamp AND a.id > b.id;
+
+DROP INDEX IF EXISTS idx_vehicle_locations_vehicle_id_timestamp;
+CREATE UNIQUE INDEX idx_vehicle_locations_vehicle_id_timestamp ON vehicle_locations(vehicle_id, timestamp);
@@ -0,0 +1,3 @@
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_geofence_event_id_fkey;
+
+DROP INDEX IF EXISTS idx_geofence_events_natural_key;
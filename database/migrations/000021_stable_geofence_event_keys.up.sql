@@ -0,0 +1,17 @@
+-- Event geofence unik per kendaraan, geofence, tipe event dan timestamp. Replay titik terlambat
+-- mempertahankan ID event yang tetap terjadi, sehingga alert tetap terhubung ke event-nya.
+DELETE FROM geofence_events a
+USING geofence_events b
+WHERE a.vehicle_id = b.vehicle_id AND a.geofence_id = b.geofence_id
+  AND a.event = b.event AND a.timestamp = b.timestamp AND a.id > b.id;
+
+CREATE UNIQUE INDEX idx_geofence_events_natural_key ON geofence_events(vehicle_id, geofence_id, event, timestamp);
+
+-- Alert dari event yang sudah dihapus oleh replay sebelumnya kehilangan referensinya
+UPDATE alerts SET geofence_event_id = NULL
+WHERE geofence_event_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM geofence_events e WHERE e.id = alerts.geofence_event_id);
+
+-- Alert tetap tersimpan untuk audit walaupun event-nya dibatalkan
+ALTER TABLE alerts ADD CONSTRAINT alerts_geofence_event_id_fkey
+    FOREIGN KEY (geofence_event_id) REFERENCES geofence_events(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- ID pesan RabbitMQ (ID outbox) dari event yang membuka alert. Pengiriman event bersifat
+-- at-least-once, sehingga event yang dikirim ulang tidak membuat alert ganda untuk semua tipe event.
+ALTER TABLE alerts ADD COLUMN message_id VARCHAR(64) UNIQUE;
@@ -0,0 +1,8 @@
+-- Bucket menit yang harus dihitung ulang karena titik lokasi tersimpan setelah job rollup
+-- melewatinya (titik terlambat atau data yang tertahan di perangkat). Diisi saat ingestion,
+-- dikosongkan oleh app/services/rollup setelah bucket dihitung ulang.
+CREATE TABLE IF NOT EXISTS rollup_dirty_buckets (
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (vehicle_id, bucket)
+);
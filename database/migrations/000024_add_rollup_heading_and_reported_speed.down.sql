@@ -0,0 +1,13 @@
+ALTER TABLE vehicle_location_rollups_1h
+    DROP COLUMN IF EXISTS avg_reported_speed,
+    DROP COLUMN IF EXISTS max_reported_speed,
+    DROP COLUMN IF EXISTS reported_speed_count,
+    DROP COLUMN IF EXISTS reported_heading,
+    DROP COLUMN IF EXISTS heading;
+
+ALTER TABLE vehicle_location_rollups_1m
+    DROP COLUMN IF EXISTS avg_reported_speed,
+    DROP COLUMN IF EXISTS max_reported_speed,
+    DROP COLUMN IF EXISTS reported_speed_count,
+    DROP COLUMN IF EXISTS reported_heading,
+    DROP COLUMN IF EXISTS heading;
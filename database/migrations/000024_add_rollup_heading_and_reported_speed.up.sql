@@ -0,0 +1,20 @@
+-- Heading titik terakhir dan kecepatan yang dikirim perangkat per bucket rollup.
+-- reported_speed_count dipakai untuk merata-ratakan kecepatan perangkat dari bucket menit ke bucket jam.
+ALTER TABLE vehicle_location_rollups_1m
+    ADD COLUMN IF NOT EXISTS heading DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS reported_heading DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS reported_speed_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_reported_speed DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS avg_reported_speed DOUBLE PRECISION;
+
+ALTER TABLE vehicle_location_rollups_1h
+    ADD COLUMN IF NOT EXISTS heading DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS reported_heading DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS reported_speed_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_reported_speed DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS avg_reported_speed DOUBLE PRECISION;
+
+-- Bucket yang sudah ada dihitung ulang oleh job rollup agar kolom baru terisi
+INSERT INTO rollup_dirty_buckets (vehicle_id, bucket)
+SELECT vehicle_id, bucket FROM vehicle_location_rollups_1m
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- Relay menahan event kendaraan selama event sebelumnya dari kendaraan yang sama belum terkirim
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_vehicle ON outbox ((payload->>'vehicle_id'), id) WHERE delivered_at IS NULL;
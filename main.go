@@ -2,11 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"tj_techtest/app/services/alert"
+	"tj_techtest/app/services/connectivity"
+	"tj_techtest/app/services/health"
+	"tj_techtest/app/services/ingest"
+	"tj_techtest/app/services/outbox"
+	"tj_techtest/app/services/partition"
+	"tj_techtest/app/services/rollup"
+	"tj_techtest/app/services/rule"
+	"tj_techtest/app/services/stream"
 	"tj_techtest/config"
+	"tj_techtest/pkg/mqtt"
 	"tj_techtest/pkg/rabbitmq"
 	"tj_techtest/routes"
 
@@ -41,8 +54,86 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	health.Register("database", func() error {
+		sqlDB, err := config.DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Ping()
+	})
+	health.Register("rabbitmq", func() error {
+		if state := rmq.State(); state != rabbitmq.StateConnected {
+			return fmt.Errorf("connection %s", state)
+		}
+		return nil
+	})
+
+	// Long-lived publisher shared by every consumer for outgoing events
+	publisher, err := rabbitmq.NewPublisher(rabbitMQURL, publisherChannels())
+	if err != nil {
+		log.Fatalf("Failed to create RabbitMQ publisher: %v", err)
+	}
+	defer publisher.Close()
+
+	// Keep daily vehicle_locations partitions ahead and expire old ones
+	go partition.Run(ctx)
+
+	// Aggregate location history into minute and hour rollups
+	go rollup.Run(ctx)
+
+	// Push stored locations to WebSocket and SSE clients of this instance
+	go stream.Run(ctx)
+
+	// Fire no update rules for vehicles that stopped reporting
+	go rule.Run(ctx)
+
+	// Mark vehicles that stopped reporting offline
+	go connectivity.Run(ctx)
+
+	// Geofence, rule and connectivity events are written to the outbox and published by the relay
+	go outbox.NewRelay(publisher).Run(ctx)
+
+	// Open alerts for fleet events, the message is only acknowledged once its alert is stored
+	if enabled, _ := strconv.ParseBool(config.GetEnv("ALERT_CONSUMER_ENABLED", "true")); enabled {
+		rabbitmq.GeofenceRetryDelay = config.GetDuration("RABBITMQ_RETRY_DELAY", rabbitmq.GeofenceRetryDelay)
+		if err := rmq.ConsumeGeofenceAlerts(ctx, alert.Store); err != nil {
+			log.Fatalf("Failed to start consuming geofence alerts: %v", err)
+		}
+	}
+
+	// Location updates from every transport go through the same ingestion pipeline
+	pipeline := ingest.NewPipeline()
+	pipelineDone := make(chan struct{})
+	go func() {
+		pipeline.Run(ctx)
+		close(pipelineDone)
+	}()
+
 	// Start consuming location updates
-	go rmq.ConsumeLocationUpdates(ctx)
+	rabbitmq.MaxRetries = config.GetInt("RABBITMQ_MAX_RETRIES", rabbitmq.MaxRetries)
+	rabbitmq.RetryDelay = config.GetDuration("RABBITMQ_RETRY_DELAY", rabbitmq.RetryDelay)
+	rabbitmq.Prefetch = config.GetInt("RABBITMQ_PREFETCH", rabbitmq.Prefetch)
+	go rmq.ConsumeLocationUpdates(ctx, pipeline.HandleJSON, ingest.IsPermanent)
+
+	// Optionally run the MQTT subscriber in the same process
+	if enabled, _ := strconv.ParseBool(os.Getenv("MQTT_ENABLED")); enabled {
+		mqttClient, err := mqtt.NewClientWithConfig(mqtt.ConfigFromEnv())
+		if err != nil {
+			log.Fatalf("Failed to connect to MQTT broker: %v", err)
+		}
+		defer mqttClient.Close()
+
+		if err := mqttClient.SubscribeToLocations(ctx, pipeline.HandleJSON, ingest.IsPermanent); err != nil {
+			log.Fatalf("Failed to subscribe to MQTT locations: %v", err)
+		}
+
+		health.Register("mqtt", func() error {
+			if !mqttClient.IsConnected() {
+				return errors.New("not connected")
+			}
+			return nil
+		})
+	}
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -54,7 +145,7 @@ func main() {
 	app.Use(cors.New())
 
 	// Setup routes
-	routes.SetupRoutes(app)
+	routes.SetupRoutes(app, rmq)
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -63,10 +154,20 @@ func main() {
 	go func() {
 		<-sigChan
 		log.Println("Shutting down gracefully...")
-		cancel() // Cancel context to stop RabbitMQ consumer
+		cancel() // Cancel context to stop RabbitMQ and MQTT consumers
 		app.Shutdown()
 	}()
 
-	// Start server
-	log.Fatal(app.Listen(":3000"))
+	// Start server; deferred Close calls run once Listen returns after shutdown
+	if err := app.Listen(":3000"); err != nil {
+		log.Fatal(err)
+	}
+
+	// Wait for the pipeline to write the locations it still holds
+	<-pipelineDone
+}
+
+// publisherChannels returns the size of the RabbitMQ publisher channel pool
+func publisherChannels() int {
+	return config.GetInt("RABBITMQ_PUBLISHER_CHANNELS", rabbitmq.DefaultPublisherChannels)
 }
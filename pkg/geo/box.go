@@ -0,0 +1,18 @@
+package geo
+
+// Box is a latitude/longitude bounding box. A box with MinLon greater than
+// MaxLon crosses the antimeridian.
+type Box struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// Contains reports whether the point lies inside the box
+func (b Box) Contains(lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
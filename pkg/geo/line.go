@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// LineString is a GeoJSON polyline of positions
+type LineString []Position
+
+// ParseLineString parses and validates the coordinates of a GeoJSON LineString
+func ParseLineString(geometryType string, coordinates json.RawMessage) (LineString, error) {
+	if geometryType != "LineString" {
+		return nil, fmt.Errorf("unsupported geometry type %q", geometryType)
+	}
+
+	var line LineString
+	if err := json.Unmarshal(coordinates, &line); err != nil {
+		return nil, fmt.Errorf("invalid linestring coordinates: %v", err)
+	}
+	if len(line) < 2 {
+		return nil, errors.New("linestring must have at least 2 positions")
+	}
+	for _, p := range line {
+		if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+			return nil, fmt.Errorf("position [%f, %f] is out of range", p[0], p[1])
+		}
+	}
+	return line, nil
+}
+
+// DistanceTo returns the shortest distance in meters from the point to the line.
+// Segments are projected onto a local equirectangular plane centered on the
+// point, which is accurate for the short distances corridor buffers use.
+func (l LineString) DistanceTo(lat, lon float64) float64 {
+	toRad := math.Pi / 180
+	cosLat := math.Cos(lat * toRad)
+	project := func(p Position) (float64, float64) {
+		x := normalizeLongitude(p[0]-lon) * toRad * cosLat * EarthRadius
+		y := (p[1] - lat) * toRad * EarthRadius
+		return x, y
+	}
+
+	best := math.Inf(1)
+	for i := 1; i < len(l); i++ {
+		ax, ay := project(l[i-1])
+		bx, by := project(l[i])
+		best = math.Min(best, distanceToSegment(ax, ay, bx, by))
+	}
+	return best
+}
+
+// distanceToSegment returns the distance from the origin to the segment AB
+func distanceToSegment(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+
+	t := 0.0
+	if lengthSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
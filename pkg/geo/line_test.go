@@ -0,0 +1,67 @@
+package geo
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestLineStringDistanceTo(t *testing.T) {
+	// Garis lurus ke timur sepanjang ekuator, lalu belok ke utara
+	route := LineString{{0, 0}, {0.01, 0}, {0.01, 0.01}}
+	antimeridian := LineString{{179.999, 0}, {-179.999, 0}}
+	meters := func(degrees float64) float64 { return degrees * math.Pi / 180 * EarthRadius }
+
+	tests := []struct {
+		name     string
+		line     LineString
+		lat, lon float64
+		want     float64
+	}{
+		{"on the line", route, 0, 0.005, 0},
+		{"on a vertex", route, 0, 0.01, 0},
+		{"beside first segment", route, 0.001, 0.005, meters(0.001)},
+		{"beside second segment", route, 0.005, 0.011, meters(0.001)},
+		{"before the start", route, 0, -0.001, meters(0.001)},
+		{"past the end", route, 0.012, 0.01, meters(0.002)},
+		{"across antimeridian", antimeridian, 0.001, 180, meters(0.001)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.line.DistanceTo(tt.lat, tt.lon)
+			// Proyeksi equirectangular cukup akurat hingga ~1 m untuk jarak pendek
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("DistanceTo(%v, %v) = %.2f m, want %.2f m", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLineString(t *testing.T) {
+	tests := []struct {
+		name         string
+		geometryType string
+		coordinates  string
+		positions    int
+		wantErr      bool
+	}{
+		{"linestring", "LineString", `[[106.8,-6.2],[106.9,-6.1]]`, 2, false},
+		{"polygon type", "Polygon", `[[[0,0],[1,0],[1,1],[0,0]]]`, 0, true},
+		{"single position", "LineString", `[[106.8,-6.2]]`, 0, true},
+		{"invalid json", "LineString", `[[106.8,-6.2]`, 0, true},
+		{"out of range", "LineString", `[[106.8,-6.2],[200,-6.1]]`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := ParseLineString(tt.geometryType, json.RawMessage(tt.coordinates))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLineString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(line) != tt.positions {
+				t.Errorf("ParseLineString() returned %d positions, want %d", len(line), tt.positions)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Position is a GeoJSON position in [longitude, latitude] order
+type Position [2]float64
+
+// Ring is a closed linear ring of positions
+type Ring []Position
+
+// Polygon is an outer ring followed by zero or more holes
+type Polygon []Ring
+
+// MultiPolygon is a set of polygons; a point is inside if it is inside any of them
+type MultiPolygon []Polygon
+
+// ParseGeoJSON parses the coordinates of a GeoJSON Polygon or MultiPolygon geometry
+func ParseGeoJSON(geometryType string, coordinates json.RawMessage) (MultiPolygon, error) {
+	var shape MultiPolygon
+
+	switch geometryType {
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid polygon coordinates: %v", err)
+		}
+		shape = MultiPolygon{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(coordinates, &shape); err != nil {
+			return nil, fmt.Errorf("invalid multipolygon coordinates: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", geometryType)
+	}
+
+	if err := shape.Validate(); err != nil {
+		return nil, err
+	}
+	return shape, nil
+}
+
+// Validate checks that every ring is closed, has at least four positions and valid coordinates
+func (m MultiPolygon) Validate() error {
+	if len(m) == 0 {
+		return errors.New("geometry has no polygons")
+	}
+
+	for _, polygon := range m {
+		if len(polygon) == 0 {
+			return errors.New("polygon has no rings")
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				return errors.New("ring must have at least 4 positions")
+			}
+			if ring[0] != ring[len(ring)-1] {
+				return errors.New("ring must be closed (first and last position equal)")
+			}
+			for _, p := range ring {
+				if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+					return fmt.Errorf("position [%f, %f] is out of range", p[0], p[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the point lies inside any polygon of the shape
+func (m MultiPolygon) Contains(lat, lon float64) bool {
+	for _, polygon := range m {
+		if polygon.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the point lies inside the outer ring and outside every hole
+func (p Polygon) Contains(lat, lon float64) bool {
+	if len(p) == 0 || !p[0].contains(lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains runs an even-odd ray casting test. Edges are straight lines in
+// longitude/latitude as defined by RFC 7946, always taking the shorter way
+// around so rings crossing the antimeridian are handled.
+func (r Ring) contains(lat, lon float64) bool {
+	// Unwrap longitudes so no edge spans more than 180 degrees
+	xs := make([]float64, len(r))
+	for i, p := range r {
+		if i == 0 {
+			xs[i] = p[0]
+			continue
+		}
+		xs[i] = xs[i-1] + normalizeLongitude(p[0]-r[i-1][0])
+	}
+
+	for _, x := range []float64{lon, lon + 360, lon - 360} {
+		if r.crossings(xs, lat, x)%2 == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// crossings counts ring edges crossed by a ray cast from the point towards +x
+func (r Ring) crossings(xs []float64, lat, lon float64) int {
+	count := 0
+	n := len(r)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := xs[i], r[i][1]
+		xj, yj := xs[j], r[j][1]
+
+		if (yi > lat) != (yj > lat) {
+			x := xi + (lat-yi)*(xj-xi)/(yj-yi)
+			if x > lon {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// normalizeLongitude maps a longitude difference to [-180, 180)
+func normalizeLongitude(d float64) float64 {
+	return math.Mod(d+540, 360) - 180
+}
@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// square returns a closed ring from (lon, lat) to (lon+size, lat+size)
+func square(lon, lat, size float64) Ring {
+	return Ring{{lon, lat}, {lon + size, lat}, {lon + size, lat + size}, {lon, lat + size}, {lon, lat}}
+}
+
+func TestPolygonContains(t *testing.T) {
+	withHole := Polygon{square(0, 0, 10), square(4, 4, 2)}
+	concave := Polygon{Ring{{0, 0}, {10, 0}, {10, 10}, {5, 5}, {0, 10}, {0, 0}}}
+	antimeridian := Polygon{Ring{{179, -1}, {-179, -1}, {-179, 1}, {179, 1}, {179, -1}}}
+
+	tests := []struct {
+		name     string
+		polygon  Polygon
+		lat, lon float64
+		want     bool
+	}{
+		{"inside", withHole, 1, 1, true},
+		{"outside", withHole, 11, 1, false},
+		{"inside hole", withHole, 5, 5, false},
+		{"between hole and outer ring", withHole, 3, 5, true},
+		{"concave inside", concave, 2, 2, true},
+		{"concave notch", concave, 8, 5, false},
+		{"across antimeridian east", antimeridian, 0, 179.5, true},
+		{"across antimeridian west", antimeridian, 0, -179.5, true},
+		{"outside antimeridian polygon", antimeridian, 0, 178, false},
+		{"empty polygon", Polygon{}, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.polygon.Contains(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiPolygonContains(t *testing.T) {
+	shape := MultiPolygon{{square(0, 0, 1)}, {square(5, 5, 1)}}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"first polygon", 0.5, 0.5, true},
+		{"second polygon", 5.5, 5.5, true},
+		{"between polygons", 3, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shape.Contains(tt.lat, tt.lon); got != tt.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		geometryType string
+		coordinates  string
+		polygons     int
+		wantErr      bool
+	}{
+		{"polygon", "Polygon", `[[[0,0],[1,0],[1,1],[0,1],[0,0]]]`, 1, false},
+		{"multipolygon", "MultiPolygon", `[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]`, 2, false},
+		{"unsupported type", "Point", `[0,0]`, 0, true},
+		{"invalid json", "Polygon", `[[[0,0]`, 0, true},
+		{"ring not closed", "Polygon", `[[[0,0],[1,0],[1,1],[0,1]]]`, 0, true},
+		{"ring too short", "Polygon", `[[[0,0],[1,0],[0,0]]]`, 0, true},
+		{"no rings", "Polygon", `[]`, 0, true},
+		{"no polygons", "MultiPolygon", `[]`, 0, true},
+		{"longitude out of range", "Polygon", `[[[0,0],[181,0],[1,1],[0,0]]]`, 0, true},
+		{"latitude out of range", "Polygon", `[[[0,0],[1,91],[1,1],[0,0]]]`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape, err := ParseGeoJSON(tt.geometryType, json.RawMessage(tt.coordinates))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGeoJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(shape) != tt.polygons {
+				t.Errorf("ParseGeoJSON() returned %d polygons, want %d", len(shape), tt.polygons)
+			}
+		})
+	}
+}
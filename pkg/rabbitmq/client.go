@@ -2,13 +2,11 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
-	"math"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
-	"tj_techtest/app/models"
-	"tj_techtest/config"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -18,96 +16,184 @@ const (
 	GeofenceExchange = "fleet.events"
 	LocationQueue    = "location.updates"
 	GeofenceQueue    = "geofence_alerts"
+
+	// Failed location messages are delayed in the retry queue before going back to
+	// location.updates; poison messages and exhausted retries end up in the dead-letter queue
+	DeadLetterExchange = "vehicle.locations.dlx"
+	DeadLetterQueue    = "location.updates.dead"
+	RetryQueue         = "location.updates.retry"
 )
 
-type LocationMessage struct {
-	VehicleID string  `json:"vehicle_id"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-	Timestamp int64   `json:"timestamp"`
-}
+// Connection states reported by Client.State
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
 
-type GeofenceEvent struct {
-	VehicleID string `json:"vehicle_id"`
-	Event     string `json:"event"`
-	Location  struct {
-		Latitude  float64 `json:"latitude"`
-		Longitude float64 `json:"longitude"`
-	} `json:"location"`
-	Timestamp int64 `json:"timestamp"`
-}
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
 
-func (c *Client) ConsumeGeofenceAlerts(ctx context.Context) (<-chan GeofenceEvent, error) {
-	msgs, err := c.channel.Consume(
-		GeofenceQueue,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
+// Prefetch is how many location messages the broker delivers before waiting for acks
+var Prefetch = 500
 
-	events := make(chan GeofenceEvent)
+// GeofenceRetryDelay is how long a fleet event that failed to process waits before it is requeued
+var GeofenceRetryDelay = 5 * time.Second
 
-	go func() {
-		defer close(events)
-		log.Printf("Started consuming from queue: %s", GeofenceQueue)
-		for msg := range msgs {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				log.Printf("Received message: %s", string(msg.Body))
-				var event GeofenceEvent
-				if err := json.Unmarshal(msg.Body, &event); err != nil {
-					log.Printf("Error decoding geofence event: %v", err)
-					continue
-				}
-				log.Printf("Successfully decoded event: %+v", event)
-				events <- event
-			}
-		}
-	}()
-
-	return events, nil
+// consumer is a registered queue consumer that is re-registered after every reconnect
+type consumer struct {
+	queue      string
+	autoAck    bool
+	prefetch   int
+	tag        string
+	deliveries chan amqp.Delivery
+	stopped    chan struct{}
 }
 
 type Client struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
+	url  string
+	done chan struct{}
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	state     string
+	consumers map[string]*consumer
+	closeOnce sync.Once
 }
 
+var consumerSeq uint64
+
 func NewClient(url string) (*Client, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
+	client := &Client{
+		url:       url,
+		done:      make(chan struct{}),
+		consumers: make(map[string]*consumer),
+	}
+
+	if err := client.connect(); err != nil {
 		return nil, err
 	}
 
+	go client.watch()
+
+	return client, nil
+}
+
+// connect dials the broker, declares the topology and re-registers every consumer
+func (c *Client) connect() error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return err
+	}
+
 	ch, err := conn.Channel()
 	if err != nil {
-		return nil, err
+		conn.Close()
+		return err
 	}
 
-	client := &Client{
-		conn:    conn,
-		channel: ch,
+	if err := declareTopology(ch); err != nil {
+		conn.Close()
+		return err
 	}
 
-	err = client.setupExchangesAndQueues()
-	if err != nil {
-		return nil, err
+	// Retries and dead letters wait for the broker confirm before acking the original
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
 	}
 
-	return client, nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = conn
+	c.channel = ch
+	c.state = StateConnected
+
+	for _, cons := range c.consumers {
+		if err := startConsumer(ch, cons); err != nil {
+			log.Printf("Failed to re-register consumer on %s: %v", cons.queue, err)
+			conn.Close()
+			return err
+		}
+		log.Printf("Re-registered consumer on queue: %s", cons.queue)
+	}
+
+	return nil
+}
+
+// watch waits for the connection or channel to close and reconnects with exponential backoff
+func (c *Client) watch() {
+	for {
+		c.mu.Lock()
+		conn, ch := c.conn, c.channel
+		c.mu.Unlock()
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		select {
+		case <-c.done:
+			return
+		case err := <-connClosed:
+			log.Printf("RabbitMQ connection closed: %v", err)
+		case err := <-chClosed:
+			log.Printf("RabbitMQ channel closed: %v", err)
+			conn.Close()
+		}
+
+		c.setState(StateReconnecting)
+
+		backoff := reconnectInitialBackoff
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+
+			if err := c.connect(); err != nil {
+				log.Printf("RabbitMQ reconnect failed, retrying in %s: %v", backoff, err)
+				backoff *= 2
+				if backoff > reconnectMaxBackoff {
+					backoff = reconnectMaxBackoff
+				}
+				continue
+			}
+
+			log.Printf("Reconnected to RabbitMQ")
+			break
+		}
+	}
+}
+
+func (c *Client) setState(state string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != StateClosed {
+		c.state = state
+	}
+}
+
+// State returns the current connection state
+func (c *Client) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// IsConnected reports whether the client currently has a live connection
+func (c *Client) IsConnected() bool {
+	return c.State() == StateConnected
 }
 
-func (c *Client) setupExchangesAndQueues() error {
+// declareTopology declares the exchanges and queues and binds them together
+func declareTopology(ch *amqp.Channel) error {
 	// Declare exchanges
-	err := c.channel.ExchangeDeclare(
+	err := ch.ExchangeDeclare(
 		LocationExchange,
 		"topic",
 		true,
@@ -120,7 +206,7 @@ func (c *Client) setupExchangesAndQueues() error {
 		return err
 	}
 
-	err = c.channel.ExchangeDeclare(
+	err = ch.ExchangeDeclare(
 		GeofenceExchange,
 		"fanout",
 		true,
@@ -134,7 +220,7 @@ func (c *Client) setupExchangesAndQueues() error {
 	}
 
 	// Declare queues
-	_, err = c.channel.QueueDeclare(
+	_, err = ch.QueueDeclare(
 		LocationQueue,
 		true,
 		false,
@@ -146,7 +232,7 @@ func (c *Client) setupExchangesAndQueues() error {
 		return err
 	}
 
-	_, err = c.channel.QueueDeclare(
+	_, err = ch.QueueDeclare(
 		GeofenceQueue,
 		true,
 		false,
@@ -159,7 +245,7 @@ func (c *Client) setupExchangesAndQueues() error {
 	}
 
 	// Bind queues to exchanges
-	err = c.channel.QueueBind(
+	err = ch.QueueBind(
 		LocationQueue,
 		"#",
 		LocationExchange,
@@ -170,7 +256,7 @@ func (c *Client) setupExchangesAndQueues() error {
 		return err
 	}
 
-	err = c.channel.QueueBind(
+	err = ch.QueueBind(
 		GeofenceQueue,
 		"",
 		GeofenceExchange,
@@ -181,169 +267,183 @@ func (c *Client) setupExchangesAndQueues() error {
 		return err
 	}
 
-	return nil
+	return declareRetryTopology(ch)
 }
 
-func (c *Client) ConsumeLocationUpdates(ctx context.Context) {
-	msgs, err := c.channel.Consume(
-		LocationQueue,
-		"",
-		true,
+// startConsumer registers the consumer on the channel and forwards its deliveries
+func startConsumer(ch *amqp.Channel, cons *consumer) error {
+	// Applies to the consumer registered next on this channel; 0 means unlimited
+	if err := ch.Qos(cons.prefetch, 0, false); err != nil {
+		return err
+	}
+
+	msgs, err := ch.Consume(
+		cons.queue,
+		cons.tag,
+		cons.autoAck,
 		false,
 		false,
 		false,
 		nil,
 	)
 	if err != nil {
-		log.Printf("Failed to register a consumer: %v", err)
-		return
+		return err
 	}
 
+	// msgs is closed when the channel goes away; the watcher starts a new forwarder after reconnecting
 	go func() {
 		for msg := range msgs {
 			select {
-			case <-ctx.Done():
+			case cons.deliveries <- msg:
+			case <-cons.stopped:
 				return
-			default:
-				var locMsg LocationMessage
-				err := json.Unmarshal(msg.Body, &locMsg)
-				if err != nil {
-					log.Printf("Error unmarshaling location message: %v", err)
-					continue
-				}
-
-				// Convert vehicle_id string to uint
-				vehicleID, err := strconv.ParseUint(locMsg.VehicleID, 10, 32)
-				if err != nil {
-					log.Printf("Error parsing vehicle_id: %v", err)
-					continue
-				}
-
-				// Save location to database
-				location := models.VehicleLocation{
-					VehicleID: uint(vehicleID),
-					Latitude:  locMsg.Latitude,
-					Longitude: locMsg.Longitude,
-					Timestamp: time.Unix(locMsg.Timestamp, 0),
-				}
-
-				if err := config.DB.Create(&location).Error; err != nil {
-					log.Printf("Error saving location: %v", err)
-					continue
-				}
-
-				// Check geofence
-				c.checkGeofence(ctx, location)
 			}
 		}
 	}()
 
-	log.Printf("Location consumer started. Waiting for messages...")
+	return nil
 }
 
-func (c *Client) checkGeofence(ctx context.Context, location models.VehicleLocation) {
-	var geofences []models.Geofence
-	if err := config.DB.Find(&geofences).Error; err != nil {
-		log.Printf("Error fetching geofences: %v", err)
-		return
+// consume registers a consumer that survives reconnects. handle is called
+// sequentially until ctx is canceled or the client is closed, then stop runs.
+// Without autoAck the handler is responsible for acknowledging each delivery,
+// and prefetch bounds how many deliveries may be unacknowledged at once.
+func (c *Client) consume(ctx context.Context, queue string, autoAck bool, prefetch int, handle func(amqp.Delivery), stop func()) error {
+	cons := &consumer{
+		queue:      queue,
+		autoAck:    autoAck,
+		prefetch:   prefetch,
+		tag:        fmt.Sprintf("%s-%d", queue, atomic.AddUint64(&consumerSeq, 1)),
+		deliveries: make(chan amqp.Delivery),
+		stopped:    make(chan struct{}),
 	}
 
-	log.Printf("Checking %d geofences for vehicle %d at location [%f, %f]",
-		len(geofences), location.VehicleID, location.Latitude, location.Longitude)
-
-	for _, geofence := range geofences {
-		if isInsideGeofence(location.Latitude, location.Longitude, geofence) {
-			log.Printf("Vehicle %d is inside geofence %s! Publishing event...", location.VehicleID, geofence.Name)
-
-			event := GeofenceEvent{
-				VehicleID: strconv.FormatUint(uint64(location.VehicleID), 10),
-				Event:     "geofence_entry",
-				Location: struct {
-					Latitude  float64 `json:"latitude"`
-					Longitude float64 `json:"longitude"`
-				}{
-					Latitude:  location.Latitude,
-					Longitude: location.Longitude,
-				},
-				Timestamp: time.Now().Unix(),
-			}
+	c.mu.Lock()
+	if err := startConsumer(c.channel, cons); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.consumers[cons.tag] = cons
+	c.mu.Unlock()
 
-			eventJSON, err := json.Marshal(event)
-			if err != nil {
-				log.Printf("Error marshaling geofence event: %v", err)
-				continue
+	go func() {
+		defer func() {
+			close(cons.stopped)
+			c.removeConsumer(cons.tag)
+			if stop != nil {
+				stop()
 			}
+		}()
 
-			err = c.channel.PublishWithContext(ctx,
-				GeofenceExchange,
-				"",
-				false,
-				false,
-				amqp.Publishing{
-					ContentType: "application/json",
-					Body:        eventJSON,
-				},
-			)
-			if err != nil {
-				log.Printf("Error publishing geofence event: %v", err)
-			} else {
-				log.Printf("Successfully published geofence event: %s", string(eventJSON))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case msg := <-cons.deliveries:
+				handle(msg)
 			}
 		}
+	}()
+
+	return nil
+}
+
+func (c *Client) removeConsumer(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.consumers, tag)
+	if c.state == StateConnected {
+		c.channel.Cancel(tag, false)
 	}
 }
 
-// Simple circular geofence check using Haversine formula
-func isInsideGeofence(lat, lon float64, geofence models.Geofence) bool {
-	const earthRadius = 6371000 // Earth radius in meters
+// EventHandler processes the raw body of a fleet event. messageID is empty
+// for events published without one.
+type EventHandler func(ctx context.Context, messageID string, body []byte) error
+
+// ConsumeGeofenceAlerts consumes geofence_alerts, which receives every event
+// published to fleet.events, with manual acknowledgements. A message is
+// acknowledged once handle succeeds; a failed message is requeued after
+// GeofenceRetryDelay, so events are not lost while the handler's storage is unavailable.
+func (c *Client) ConsumeGeofenceAlerts(ctx context.Context, handle EventHandler) error {
+	err := c.consume(ctx, GeofenceQueue, false, 1, func(msg amqp.Delivery) {
+		if err := handle(ctx, msg.MessageId, msg.Body); err != nil {
+			log.Printf("Error processing fleet event, requeueing in %s: %v", GeofenceRetryDelay, err)
+			select {
+			case <-time.After(GeofenceRetryDelay):
+			case <-ctx.Done():
+			case <-c.done:
+			}
+			msg.Nack(false, true)
+			return
+		}
+		msg.Ack(false)
+	}, nil)
+	if err != nil {
+		return err
+	}
 
-	// Convert latitude and longitude to radians
-	lat1 := lat * (math.Pi / 180)
-	lon1 := lon * (math.Pi / 180)
-	lat2 := geofence.Latitude * (math.Pi / 180)
-	lon2 := geofence.Longitude * (math.Pi / 180)
+	log.Printf("Started consuming from queue: %s", GeofenceQueue)
+	return nil
+}
 
-	// Calculate differences
-	dlat := lat2 - lat1
-	dlon := lon2 - lon1
+// LocationHandler processes the raw body of a location message
+type LocationHandler func(ctx context.Context, body []byte) error
+
+// ConsumeLocationUpdates consumes location.updates with manual acknowledgements.
+// Messages for which isPoison reports true go straight to the dead-letter queue,
+// other failures are retried up to MaxRetries times before being dead-lettered.
+// Up to Prefetch messages are handled concurrently so the handler can batch them.
+func (c *Client) ConsumeLocationUpdates(ctx context.Context, handle LocationHandler, isPoison func(error) bool) {
+	prefetch := Prefetch
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+	inFlight := make(chan struct{}, prefetch)
 
-	// Calculate distance using Haversine formula
-	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
-		math.Cos(lat1)*math.Cos(lat2)*
-			math.Sin(dlon/2)*math.Sin(dlon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	distance := earthRadius * c
+	err := c.consume(ctx, LocationQueue, false, prefetch, func(msg amqp.Delivery) {
+		inFlight <- struct{}{}
+		go func() {
+			defer func() { <-inFlight }()
 
-	log.Printf("Distance to geofence %s: %.2f meters (radius: %.2f meters)",
-		geofence.Name, distance, geofence.Radius)
+			err := handle(ctx, msg.Body)
+			if err == nil {
+				msg.Ack(false)
+				return
+			}
 
-	return distance <= geofence.Radius
+			log.Printf("Error processing location message: %v", err)
+			if isPoison != nil && isPoison(err) {
+				c.deadLetter(ctx, msg, err)
+			} else {
+				c.retry(ctx, msg, err)
+			}
+		}()
+	}, nil)
+	if err != nil {
+		log.Printf("Failed to register a consumer: %v", err)
+		return
+	}
+
+	log.Printf("Location consumer started. Waiting for messages...")
 }
 
 func (c *Client) Close() {
-	if c.channel != nil {
-		c.channel.Close()
-	}
-	if c.conn != nil {
-		c.conn.Close()
-	}
-}
+	c.closeOnce.Do(func() {
+		close(c.done)
 
-func (c *Client) PublishGeofenceEvent(event GeofenceEvent) error {
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
+		c.mu.Lock()
+		defer c.mu.Unlock()
 
-	err = c.channel.Publish(
-		GeofenceExchange,
-		"",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        eventJSON,
-		},
-	)
-	return err
+		c.state = StateClosed
+		if c.channel != nil {
+			c.channel.Close()
+		}
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
 }
@@ -0,0 +1,332 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	HeaderRetryCount   = "x-retry-count"
+	HeaderDeathReason  = "x-death-reason"
+	HeaderFailedAt     = "x-failed-at"
+	HeaderOriginalKey  = "x-original-routing-key"
+	maxDeadLetterBatch = 1000
+)
+
+var (
+	// ErrNotConnected is returned by dead-letter operations while the client is reconnecting
+	ErrNotConnected = errors.New("rabbitmq is not connected")
+
+	// MaxRetries is how many times a failing location message is redelivered before it is dead-lettered
+	MaxRetries = 5
+
+	// RetryDelay is how long a failed message waits in the retry queue
+	RetryDelay = 5 * time.Second
+)
+
+// DeadLetter is a location message that could not be processed
+type DeadLetter struct {
+	Body       string    `json:"body"`
+	Reason     string    `json:"reason"`
+	RetryCount int       `json:"retry_count"`
+	RoutingKey string    `json:"routing_key"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// declareRetryTopology declares the retry queue and the dead-letter exchange/queue
+func declareRetryTopology(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		DeadLetterExchange,
+		"direct",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(
+		DeadLetterQueue,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = ch.QueueBind(
+		DeadLetterQueue,
+		LocationQueue,
+		DeadLetterExchange,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Expired retry messages are routed straight back to location.updates
+	_, err = ch.QueueDeclare(
+		RetryQueue,
+		true,
+		false,
+		false,
+		false,
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": LocationQueue,
+		},
+	)
+	return err
+}
+
+// retryCount reads the retry counter header of a delivery
+func retryCount(headers amqp.Table) int {
+	switch v := headers[HeaderRetryCount].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	}
+	return 0
+}
+
+// copyHeaders returns a copy of the delivery headers that can be modified
+func copyHeaders(headers amqp.Table) amqp.Table {
+	table := amqp.Table{}
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
+
+// publishRaw publishes on the shared channel and waits for the broker confirm
+func (c *Client) publishRaw(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	c.mu.Lock()
+	ch := c.channel
+	c.mu.Unlock()
+
+	return publishConfirmed(ctx, ch, exchange, key, msg)
+}
+
+// publishConfirmed publishes on a channel in confirm mode and returns once the
+// broker has taken responsibility for the message, so the source can be acked
+func publishConfirmed(ctx context.Context, ch *amqp.Channel, exchange, key string, msg amqp.Publishing) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishConfirmTimeout)
+		defer cancel()
+	}
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("message to %q was nacked by the broker", key)
+	}
+	return nil
+}
+
+// retry schedules the message for redelivery, or dead-letters it once MaxRetries is reached
+func (c *Client) retry(ctx context.Context, msg amqp.Delivery, cause error) {
+	count := retryCount(msg.Headers) + 1
+	if count > MaxRetries {
+		c.deadLetter(ctx, msg, fmt.Errorf("retries exhausted: %w", cause))
+		return
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[HeaderRetryCount] = int32(count)
+	headers[HeaderDeathReason] = cause.Error()
+
+	err := c.publishRaw(ctx, "", RetryQueue, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Expiration:   strconv.FormatInt(RetryDelay.Milliseconds(), 10),
+		Body:         msg.Body,
+	})
+	if err != nil {
+		log.Printf("Failed to schedule retry, requeueing message: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Scheduled retry %d/%d for location message in %s", count, MaxRetries, RetryDelay)
+	msg.Ack(false)
+}
+
+// deadLetter moves the message to the dead-letter queue with the failure reason
+func (c *Client) deadLetter(ctx context.Context, msg amqp.Delivery, cause error) {
+	headers := copyHeaders(msg.Headers)
+	headers[HeaderDeathReason] = cause.Error()
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	if _, ok := headers[HeaderOriginalKey]; !ok {
+		headers[HeaderOriginalKey] = msg.RoutingKey
+	}
+
+	err := c.publishRaw(ctx, DeadLetterExchange, LocationQueue, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         msg.Body,
+	})
+	if err != nil {
+		log.Printf("Failed to dead-letter message, requeueing: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Moved location message to %s: %v", DeadLetterQueue, cause)
+	msg.Ack(false)
+}
+
+// openChannel opens a dedicated channel so that basic.get deliveries don't
+// interfere with the acknowledgements of the consumers
+func (c *Client) openChannel() (*amqp.Channel, error) {
+	c.mu.Lock()
+	conn := c.conn
+	state := c.state
+	c.mu.Unlock()
+
+	if state != StateConnected {
+		return nil, fmt.Errorf("%w: connection %s", ErrNotConnected, state)
+	}
+	return conn.Channel()
+}
+
+// PeekDeadLetters returns up to limit dead-lettered messages without removing them
+func (c *Client) PeekDeadLetters(limit int) ([]DeadLetter, error) {
+	ch, err := c.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	// Closing the channel returns every unacknowledged message to the queue in order
+	defer ch.Close()
+
+	letters := []DeadLetter{}
+	for len(letters) < clampBatch(limit) {
+		msg, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		letters = append(letters, toDeadLetter(msg))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters republishes up to limit dead-lettered messages to
+// location.updates with a fresh retry counter and returns how many were replayed.
+// A dead letter is only removed once the broker confirmed its republished copy.
+// Only the messages queued when the replay starts are replayed, so a message
+// that fails again and is dead-lettered during the replay isn't replayed twice.
+func (c *Client) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	ch, err := c.openChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return 0, err
+	}
+
+	// Pesan yang masuk ke dead-letter queue setelah ini berada di belakang antrean
+	queue, err := ch.QueueDeclarePassive(DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	limit = clampBatch(limit)
+	if queue.Messages < limit {
+		limit = queue.Messages
+	}
+
+	replayed := 0
+	for replayed < limit {
+		msg, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := copyHeaders(msg.Headers)
+		delete(headers, HeaderRetryCount)
+		delete(headers, HeaderDeathReason)
+		delete(headers, HeaderFailedAt)
+
+		err = publishConfirmed(ctx, ch, "", LocationQueue, amqp.Publishing{
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         msg.Body,
+		})
+		if err != nil {
+			msg.Nack(false, true)
+			return replayed, err
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func clampBatch(limit int) int {
+	if limit <= 0 || limit > maxDeadLetterBatch {
+		return maxDeadLetterBatch
+	}
+	return limit
+}
+
+func toDeadLetter(msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Body:       string(msg.Body),
+		RetryCount: retryCount(msg.Headers),
+		RoutingKey: msg.RoutingKey,
+	}
+	if reason, ok := msg.Headers[HeaderDeathReason].(string); ok {
+		letter.Reason = reason
+	}
+	if key, ok := msg.Headers[HeaderOriginalKey].(string); ok {
+		letter.RoutingKey = key
+	}
+	if failedAt, ok := msg.Headers[HeaderFailedAt].(string); ok {
+		letter.FailedAt, _ = time.Parse(time.RFC3339, failedAt)
+	}
+	return letter
+}
@@ -0,0 +1,221 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	DefaultPublisherChannels = 4
+
+	// publishConfirmTimeout bounds the wait for a broker confirm when the context has no deadline
+	publishConfirmTimeout = 5 * time.Second
+)
+
+// ErrPublisherClosed is returned when publishing on a closed publisher
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// pooledChannel is a confirm-mode channel tied to the connection that opened it
+type pooledChannel struct {
+	channel *amqp.Channel
+	conn    *amqp.Connection
+}
+
+// Publisher is a long-lived, concurrency-safe AMQP publisher. It keeps a pool
+// of confirm-mode channels on a single connection, waits for broker confirms
+// and transparently reconnects when the connection is lost.
+type Publisher struct {
+	url  string
+	size int
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	closed bool
+
+	pool chan *pooledChannel
+}
+
+// NewPublisher connects to the broker and declares the exchanges it publishes to
+func NewPublisher(url string, channels int) (*Publisher, error) {
+	if channels <= 0 {
+		channels = DefaultPublisherChannels
+	}
+
+	p := &Publisher{
+		url:  url,
+		size: channels,
+		pool: make(chan *pooledChannel, channels),
+	}
+
+	if _, err := p.connection(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// connection returns the current connection, dialing a new one if it was lost
+func (p *Publisher) connection() (*amqp.Connection, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPublisherClosed
+	}
+	if p.conn != nil && !p.conn.IsClosed() {
+		return p.conn, nil
+	}
+
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer ch.Close()
+
+	if err := declareTopology(ch); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if p.conn != nil {
+		log.Printf("RabbitMQ publisher reconnected")
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+// acquire takes a channel from the pool or opens a new one
+func (p *Publisher) acquire() (*pooledChannel, error) {
+	conn, err := p.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case pc := <-p.pool:
+			// Drop channels from a previous connection or closed by the broker
+			if pc.conn != conn || pc.channel.IsClosed() {
+				pc.channel.Close()
+				continue
+			}
+			return pc, nil
+		default:
+			ch, err := conn.Channel()
+			if err != nil {
+				return nil, err
+			}
+			if err := ch.Confirm(false); err != nil {
+				ch.Close()
+				return nil, err
+			}
+			return &pooledChannel{channel: ch, conn: conn}, nil
+		}
+	}
+}
+
+// release returns a healthy channel to the pool, closing it if the pool is full
+func (p *Publisher) release(pc *pooledChannel) {
+	if pc.channel.IsClosed() {
+		return
+	}
+	select {
+	case p.pool <- pc:
+	default:
+		pc.channel.Close()
+	}
+}
+
+// Publish sends a persistent message and waits for the broker to confirm it.
+// messageID, if not empty, lets consumers recognize a message delivered twice.
+// A failed attempt is retried once on a fresh channel (and connection).
+func (p *Publisher) Publish(ctx context.Context, exchange, routingKey, messageID string, body []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishConfirmTimeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = p.publishOnce(ctx, exchange, routingKey, messageID, body); err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrPublisherClosed) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *Publisher) publishOnce(ctx context.Context, exchange, routingKey, messageID string, body []byte) error {
+	pc, err := p.acquire()
+	if err != nil {
+		return err
+	}
+
+	confirm, err := pc.channel.PublishWithDeferredConfirmWithContext(ctx,
+		exchange,
+		routingKey,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    messageID,
+			Timestamp:    time.Now(),
+			Body:         body,
+		},
+	)
+	if err != nil {
+		pc.channel.Close()
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		// The confirm may still arrive later; don't reuse a channel with one outstanding
+		pc.channel.Close()
+		return err
+	}
+	p.release(pc)
+
+	if !acked {
+		return fmt.Errorf("message to %s was nacked by the broker", exchange)
+	}
+	return nil
+}
+
+// Close closes every pooled channel and the connection
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+
+	for {
+		select {
+		case pc := <-p.pool:
+			pc.channel.Close()
+		default:
+			if p.conn != nil {
+				p.conn.Close()
+			}
+			return
+		}
+	}
+}
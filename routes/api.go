@@ -2,22 +2,37 @@ package routes
 
 import (
 	"tj_techtest/app/http/controllers"
+	"tj_techtest/pkg/rabbitmq"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 )
 
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, rmq *rabbitmq.Client) {
 	// Initialize controllers
 	vehicleController := &controllers.VehicleController{}
 	geofenceController := &controllers.GeofenceController{}
+	healthController := &controllers.HealthController{}
+	deadLetterController := &controllers.DeadLetterController{RabbitMQ: rmq}
+	streamController := &controllers.StreamController{}
+	geofenceEventController := &controllers.GeofenceEventController{}
+	alertController := &controllers.AlertController{}
+	ruleController := &controllers.RuleController{}
+
+	// Health check
+	app.Get("/health", healthController.GetHealth)
 
 	// Vehicle routes
 	vehicles := app.Group("/vehicles")
 	vehicles.Get("/", vehicleController.GetVehicles)
 	vehicles.Post("/", vehicleController.CreateVehicle)
+	vehicles.Get("/locations", vehicleController.GetCurrentLocations)
 	vehicles.Get("/:id", vehicleController.GetVehicle)
+	vehicles.Put("/:id", vehicleController.UpdateVehicle)
 	vehicles.Get("/:id/history", vehicleController.GetVehicleLocations)
 	vehicles.Get("/:id/location", vehicleController.GetLastLocation)
+	vehicles.Get("/:id/trips", vehicleController.GetVehicleTrips)
+	vehicles.Get("/:id/stops", vehicleController.GetVehicleStops)
 
 	// Geofence routes
 	geofences := app.Group("/geofences")
@@ -26,4 +41,34 @@ func SetupRoutes(app *fiber.App) {
 	geofences.Get("/:id", geofenceController.GetGeofence)
 	geofences.Put("/:id", geofenceController.UpdateGeofence)
 	geofences.Delete("/:id", geofenceController.DeleteGeofence)
+
+	// Recorded geofence events
+	app.Get("/geofence-events", geofenceEventController.GetGeofenceEvents)
+
+	// Alert rules defined by operators
+	rules := app.Group("/rules")
+	rules.Get("/", ruleController.GetRules)
+	rules.Post("/", ruleController.CreateRule)
+	rules.Get("/:id", ruleController.GetRule)
+	rules.Put("/:id", ruleController.UpdateRule)
+	rules.Delete("/:id", ruleController.DeleteRule)
+	rules.Get("/:id/events", ruleController.GetRuleEvents)
+
+	// Alerts handled by dispatchers
+	alerts := app.Group("/alerts")
+	alerts.Get("/", alertController.GetAlerts)
+	alerts.Get("/:id", alertController.GetAlert)
+	alerts.Post("/:id/acknowledge", alertController.AcknowledgeAlert)
+	alerts.Post("/:id/resolve", alertController.ResolveAlert)
+
+	// Live location and geofence event streams
+	app.Get("/ws/locations", streamController.UpgradeLocations, websocket.New(streamController.StreamLocationsWS))
+	app.Get("/events/locations", streamController.StreamLocationsSSE)
+	app.Get("/ws/geofence-events", streamController.UpgradeGeofenceEvents, websocket.New(streamController.StreamGeofenceEventsWS))
+	app.Get("/events/geofence-events", streamController.StreamGeofenceEventsSSE)
+
+	// Dead-lettered location messages
+	deadLetters := app.Group("/dead-letters")
+	deadLetters.Get("/", deadLetterController.GetDeadLetters)
+	deadLetters.Post("/replay", deadLetterController.ReplayDeadLetters)
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"tj_techtest/app/models"
+	"tj_techtest/app/services/trip"
+	"tj_techtest/config"
+
+	"github.com/joho/godotenv"
+)
+
+// Menghitung ulang tabel trips dari seluruh riwayat lokasi.
+//
+//	go run scripts/backfill_trips/main.go              # semua kendaraan
+//	go run scripts/backfill_trips/main.go -vehicle 1   # satu kendaraan
+func main() {
+	vehicleID := flag.Uint("vehicle", 0, "ID kendaraan (0 untuk semua kendaraan)")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found or error loading: %v", err)
+	}
+	config.ConnectDB()
+
+	var ids []uint
+	if *vehicleID != 0 {
+		ids = []uint{*vehicleID}
+	} else if err := config.DB.Model(&models.Vehicle{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		log.Fatalf("Failed to list vehicles: %v", err)
+	}
+
+	for _, id := range ids {
+		points, err := trip.Backfill(id)
+		if err != nil {
+			log.Fatalf("Failed to backfill trips for vehicle %d: %v", id, err)
+		}
+
+		var trips int64
+		config.DB.Model(&models.Trip{}).Where("vehicle_id = ?", id).Count(&trips)
+		log.Printf("Vehicle %d: %d points, %d trips", id, points, trips)
+	}
+}
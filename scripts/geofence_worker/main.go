@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"tj_techtest/app/services/alert"
+	"tj_techtest/config"
 	"tj_techtest/pkg/rabbitmq"
 
 	"github.com/joho/godotenv"
@@ -17,6 +19,8 @@ func main() {
 		log.Printf("Warning: .env file not found or error loading: %v", err)
 	}
 
+	config.ConnectDB()
+
 	// Get RabbitMQ URL from environment
 	rabbitMQURL := os.Getenv("RABBITMQ_URL")
 	if rabbitMQURL == "" {
@@ -30,12 +34,14 @@ func main() {
 	}
 	defer rmq.Close()
 
+	rabbitmq.GeofenceRetryDelay = config.GetDuration("RABBITMQ_RETRY_DELAY", rabbitmq.GeofenceRetryDelay)
+
 	// Create context that will be canceled on shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start consuming geofence alerts
-	alerts, err := rmq.ConsumeGeofenceAlerts(ctx)
+	// Start consuming geofence alerts, the message is only acknowledged once its alert is stored
+	err = rmq.ConsumeGeofenceAlerts(ctx, alert.Store)
 	if err != nil {
 		log.Fatalf("Failed to start consuming geofence alerts: %v", err)
 	}
@@ -50,13 +56,6 @@ func main() {
 		cancel()
 	}()
 
-	// Process geofence alerts
 	log.Println("Geofence worker started. Waiting for alerts...")
-	for alert := range alerts {
-		log.Printf("Received geofence alert: Vehicle %s entered geofence at location [%f, %f]",
-			alert.VehicleID,
-			alert.Location.Latitude,
-			alert.Location.Longitude,
-		)
-	}
+	<-ctx.Done()
 }